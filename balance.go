@@ -0,0 +1,204 @@
+package glicko2
+
+import (
+	"math"
+	"sort"
+)
+
+// 划分阵营时最多搜索的节点数，超过后使用当前找到的最优解
+const maxPartitionSearchNodes = 200000
+
+// BalancedStrategy 在 Base 组成房间后，把房间中的所有队伍重新划分到各个阵营中，使各阵营的平均 mmr 尽量接近。
+// 队伍不会被拆开，带 ai 的房间不做调整。重新划分后的阵营和房间同样要满足 MatchRange 的限制，
+// 找不到满足限制的划分时保留 Base 组成的房间。
+type BalancedStrategy struct {
+	Base MatchStrategy // 选出房间的策略，为空时使用 GreedyStrategy
+}
+
+func (s BalancedStrategy) Match(q *Queue, state MatchState) ([]Room, MatchState) {
+	base := s.Base
+	if base == nil {
+		base = GreedyStrategy{}
+	}
+
+	rooms, left := base.Match(q, state)
+	for i, room := range rooms {
+		if room.HasAi() {
+			continue
+		}
+		groups := make([]Group, 0, q.RoomPlayerLimit)
+		for _, t := range room.Teams() {
+			groups = append(groups, t.Groups()...)
+		}
+		parts, ok := partitionTeams(groups, q.RoomTeamLimit, q.TeamPlayerLimit, func(member, g Group) bool {
+			return GreedyStrategy{}.canGroupPair(q, member, g)
+		})
+		if !ok {
+			continue
+		}
+		if newRoom, ok := s.buildRoom(q, parts); ok {
+			rooms[i] = newRoom
+		}
+	}
+	return rooms, left
+}
+
+// buildRoom 按划分结果组成房间，阵营之间不满足 MatchRange 的限制时返回 false
+func (s BalancedStrategy) buildRoom(q *Queue, parts [][]Group) (Room, bool) {
+	room := q.NewRoom()
+	for _, part := range parts {
+		team := q.NewTeam()
+		for _, g := range part {
+			team.AddGroup(g)
+		}
+		if len(room.Teams()) != 0 && !(GreedyStrategy{}).canTeamTogether(q, room, team) {
+			return nil, false
+		}
+		room.AddTeam(team)
+	}
+	return room, true
+}
+
+// PartitionTeams 把 groups 划分成 teamCount 个满员的阵营，使各阵营平均 mmr 的极差最小。
+// 队伍不会被拆开，当玩家总数不等于 teamCount*teamPlayerLimit 或者无法恰好组满时返回 false。
+func PartitionTeams(groups []Group, teamCount, teamPlayerLimit int) ([][]Group, bool) {
+	return partitionTeams(groups, teamCount, teamPlayerLimit, nil)
+}
+
+// partitionTeams 同 PartitionTeams，fits 不为空时，只有 fits(已在阵营中的队伍, g) 对阵营中所有队伍都成立时 g 才能加入该阵营
+func partitionTeams(groups []Group, teamCount, teamPlayerLimit int, fits func(member, g Group) bool) ([][]Group, bool) {
+	if teamCount <= 0 || teamPlayerLimit <= 0 {
+		return nil, false
+	}
+
+	total := 0
+	items := make([]partitionItem, len(groups))
+	for i, g := range groups {
+		size := len(g.Players())
+		if size > teamPlayerLimit {
+			return nil, false
+		}
+		items[i] = partitionItem{group: g, size: size, score: g.MMR() * float64(size)}
+		total += size
+	}
+	if total != teamCount*teamPlayerLimit {
+		return nil, false
+	}
+
+	// 人数多的队伍先放，剪枝效果更好
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].size != items[j].size {
+			return items[i].size > items[j].size
+		}
+		return items[i].score > items[j].score
+	})
+
+	p := &partitioner{
+		items:  items,
+		limit:  teamPlayerLimit,
+		fits:   fits,
+		sizes:  make([]int, teamCount),
+		sums:   make([]float64, teamCount),
+		assign: make([]int, len(items)),
+	}
+	p.search(0)
+	if p.best == nil {
+		return nil, false
+	}
+
+	res := make([][]Group, teamCount)
+	for i, t := range p.best {
+		res[t] = append(res[t], items[i].group)
+	}
+	return res, true
+}
+
+type partitionItem struct {
+	group Group
+	size  int
+	score float64 // mmr * 人数
+}
+
+// partitioner 通过带剪枝的深度优先搜索划分阵营
+type partitioner struct {
+	items  []partitionItem
+	limit  int
+	fits   func(member, g Group) bool
+	sizes  []int     // 每个阵营当前的人数
+	sums   []float64 // 每个阵营当前的 mmr 总和
+	assign []int     // 每个队伍分配到的阵营
+
+	best       []int
+	bestSpread float64
+	nodes      int
+}
+
+func (p *partitioner) search(i int) {
+	if p.nodes >= maxPartitionSearchNodes || (p.best != nil && p.bestSpread == 0) {
+		return
+	}
+	p.nodes++
+
+	if i == len(p.items) {
+		spread := p.fullSpread()
+		if p.best == nil || spread < p.bestSpread {
+			p.best = append(p.best[:0], p.assign...)
+			p.bestSpread = spread
+		}
+		return
+	}
+
+	item := p.items[i]
+	triedEmpty := false
+	for t := range p.sizes {
+		if p.sizes[t]+item.size > p.limit {
+			continue
+		}
+		// 空的阵营之间是等价的，只需要尝试一个
+		if p.sizes[t] == 0 {
+			if triedEmpty {
+				continue
+			}
+			triedEmpty = true
+		} else if !p.canJoin(i, t) {
+			continue
+		}
+		p.sizes[t] += item.size
+		p.sums[t] += item.score
+		p.assign[i] = t
+		if p.best == nil || p.fullSpread() < p.bestSpread {
+			p.search(i + 1)
+		}
+		p.sizes[t] -= item.size
+		p.sums[t] -= item.score
+	}
+}
+
+// canJoin 判断第 i 个队伍能否加入阵营 t
+func (p *partitioner) canJoin(i, t int) bool {
+	if p.fits == nil {
+		return true
+	}
+	for j := 0; j < i; j++ {
+		if p.assign[j] == t && !p.fits(p.items[j].group, p.items[i].group) {
+			return false
+		}
+	}
+	return true
+}
+
+// fullSpread 计算已经满员的阵营之间平均 mmr 的极差
+func (p *partitioner) fullSpread() float64 {
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for t, size := range p.sizes {
+		if size != p.limit {
+			continue
+		}
+		lowest = math.Min(lowest, p.sums[t])
+		highest = math.Max(highest, p.sums[t])
+	}
+	if highest < lowest {
+		return 0
+	}
+	return (highest - lowest) / float64(p.limit)
+}
@@ -0,0 +1,102 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hedon954/glicko2-matcher"
+)
+
+func Test_PartitionTeams(t *testing.T) {
+	groups := make([]glicko2.Group, 0)
+
+	// 一个 2 人车队和 4 个单排玩家，分成 2 个 3 人阵营
+	duo := NewGroup("duo", []glicko2.Player{
+		NewPlayer("duo-1", false, 0, glicko2.Args{MMR: 2000}),
+		NewPlayer("duo-2", false, 0, glicko2.Args{MMR: 2000}),
+	})
+	groups = append(groups, duo)
+	for i, mmr := range []float64{1000, 1200, 1800, 3000} {
+		p := NewPlayer(fmt.Sprintf("solo-%d", i+1), false, 0, glicko2.Args{MMR: mmr})
+		groups = append(groups, NewGroup(fmt.Sprintf("solo-%d", i+1), []glicko2.Player{p}))
+	}
+
+	parts, ok := glicko2.PartitionTeams(groups, 2, 3)
+	if !ok {
+		t.Fatal("expected a partition")
+	}
+
+	// 最优解：{duo, 1200} = 5200，{1000, 1800, 3000} = 5800
+	totals := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		total, count := 0.0, 0
+		for _, g := range part {
+			total += g.MMR() * float64(len(g.Players()))
+			count += len(g.Players())
+		}
+		if count != 3 {
+			t.Fatalf("expected 3 players per team, got %d", count)
+		}
+		totals = append(totals, total/float64(count))
+	}
+	if spread := math.Abs(totals[0] - totals[1]); math.Abs(spread-200) > 1e-6 {
+		t.Fatalf("expected spread 200.00, got %.2f", spread)
+	}
+
+	if _, ok := glicko2.PartitionTeams(groups[1:], 2, 3); ok {
+		t.Fatal("expected no partition when player count does not fill the teams")
+	}
+}
+
+func Test_BalancedStrategy(t *testing.T) {
+	roomChan := make(chan glicko2.Room, 1)
+	qm := glicko2.NewMatcher(roomChan, glicko2.MatcherArgs{
+		TickInterval: 50 * time.Millisecond,
+		QueueArgs: glicko2.QueueArgs{
+			RoomPlayerLimit: 4,
+			TeamPlayerLimit: 2,
+			RoomTeamLimit:   2,
+			MatchRanges: []glicko2.MatchRange{
+				{MaxMatchSec: 3600, MMRGapPercent: 10},
+			},
+			Strategy: glicko2.BalancedStrategy{},
+		},
+	}, NewTeam, NewRoom, NewRoomWithAi)
+	defer qm.Stop()
+
+	// GreedyStrategy 组成 {1000, 1050} 和 {1100, 1150}，极差 100。
+	// {1000, 1150} 和 {1050, 1100} 极差为 0，但 1000 和 1150 的差距超过了 10%，最优的合法划分是 {1000, 1100} 和 {1050, 1150}
+	for _, mmr := range []float64{1000, 1050, 1100, 1150} {
+		id := fmt.Sprintf("%.0f", mmr)
+		p := NewPlayer(id, false, 0, glicko2.Args{MMR: mmr})
+		if err := qm.AddGroups(NewGroup(id, []glicko2.Player{p})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := qm.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case room := <-roomChan:
+		teams := make(map[string]bool)
+		for _, team := range room.Teams() {
+			ids := make([]string, 0, 2)
+			for _, g := range team.Groups() {
+				ids = append(ids, g.ID())
+			}
+			sort.Strings(ids)
+			teams[strings.Join(ids, ",")] = true
+		}
+		if len(teams) != 2 || !teams["1000,1100"] || !teams["1050,1150"] {
+			t.Fatalf("expected teams {1000, 1100} and {1050, 1150}, got %v", teams)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a matched room")
+	}
+}
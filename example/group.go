@@ -107,7 +107,7 @@ func (g *Group) RemovePlayer(player glicko2.Player) {
 func (g *Group) AverageMMR() float64 {
 	total := 0.0
 	for _, player := range g.players {
-		total += player.MMR()
+		total += glicko2.MatchingMMR(player)
 	}
 	return total / float64(len(g.players))
 }
@@ -116,7 +116,7 @@ func (g *Group) AverageMMR() float64 {
 func (g *Group) BiggestMMR() float64 {
 	mmr := 0.0
 	for _, p := range g.players {
-		pMMR := p.MMR()
+		pMMR := glicko2.MatchingMMR(p)
 		if pMMR > mmr {
 			mmr = pMMR
 		}
@@ -158,7 +158,7 @@ func (g *Group) Star() int {
 func (g *Group) MMRVariance() float64 {
 	data := stats.Float64Data{}
 	for _, p := range g.players {
-		data = append(data, p.MMR())
+		data = append(data, glicko2.MatchingMMR(p))
 	}
 	variance, _ := stats.Variance(data)
 	return variance
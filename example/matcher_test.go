@@ -1,6 +1,8 @@
 package example
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -12,12 +14,34 @@ import (
 	"github.com/hedon954/glicko2-matcher"
 )
 
+// printObserver 每轮匹配结束后打印队列状态
+type printObserver struct {
+	glicko2.NopObserver
+}
+
+func (printObserver) OnRoundFinished(queue string, stat glicko2.QueueStat) {
+	fmt.Printf("%s\t\tTmpTeam: %d\t\tTmpRoom: %d\t\tGroup: %d\t\tRoom: %d\t\tCost: %s\n", queue,
+		stat.TmpTeams, stat.TmpRooms, stat.Groups, stat.Rooms, stat.Duration)
+}
+
+// countObserver 统计匹配事件的次数
+type countObserver struct {
+	glicko2.NopObserver
+	enqueued, teams, rooms, emitted atomic.Int64
+}
+
+func (o *countObserver) OnGroupEnqueued(string, glicko2.Group) { o.enqueued.Add(1) }
+func (o *countObserver) OnTeamFormed(string, glicko2.Team)     { o.teams.Add(1) }
+func (o *countObserver) OnRoomFormed(string, glicko2.Room)     { o.rooms.Add(1) }
+func (o *countObserver) OnRoomEmitted(glicko2.MatchResult)     { o.emitted.Add(1) }
+
 func Test_Matcher(t *testing.T) {
 	rand.Seed(time.Now().UnixNano())
 
 	var roomId = atomic.Int64{}
 
 	roomChan := make(chan glicko2.Room, 128)
+	resultChan := make(chan glicko2.MatchResult, 128)
 
 	queueArgs := glicko2.QueueArgs{
 		RoomPlayerLimit:           RoomPlayerLimit,
@@ -26,6 +50,7 @@ func Test_Matcher(t *testing.T) {
 		NormalTeamWaitTimeSec:     NormalTeamWaitTimeSec,
 		UnfriendlyTeamWaitTimeSec: UnfriendlyTeamWaitTimeSec,
 		MaliciousTeamWaitTimeSec:  MaliciousTeamWaitTimeSec,
+		TriggerPlayerCount:        RoomPlayerLimit,
 		MatchRanges: []glicko2.MatchRange{
 			{
 				MaxMatchSec:   1,
@@ -54,7 +79,13 @@ func Test_Matcher(t *testing.T) {
 		},
 	}
 
-	qm := glicko2.NewMatcher(roomChan, queueArgs, NewTeam, NewRoom, NewRoomWithAi)
+	qm := glicko2.NewMatcher(roomChan, glicko2.MatcherArgs{
+		TickInterval:     50 * time.Millisecond,
+		MinRoundInterval: 10 * time.Millisecond,
+		QueueArgs:        queueArgs,
+		ResultChan:       resultChan,
+		Observers:        []glicko2.MatcherObserver{printObserver{}},
+	}, NewTeam, NewRoom, NewRoomWithAi)
 
 	// 异步随机生成 group
 	go func() {
@@ -71,18 +102,26 @@ func Test_Matcher(t *testing.T) {
 				players = append(players, p)
 			}
 			newGroup := NewGroup(fmt.Sprintf("Group%d", i+1), players)
-			qm.AddGroups(newGroup)
-			ssec := rand.Intn(200)
+			if err := qm.AddGroups(newGroup); err != nil {
+				return
+			}
+			ssec := rand.Intn(20)
 			time.Sleep(time.Duration(ssec) * time.Millisecond)
 		}
 	}()
 
-	// 异步启动匹配
-	go qm.Match()
+	// 异步启动匹配，收到中断信号或者运行一段时间后退出
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	ctx, cancelTimeout := context.WithTimeout(ctx, 2*time.Second)
+	defer cancelTimeout()
+	if err := qm.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := qm.Start(ctx); err != glicko2.ErrMatcherStarted {
+		t.Fatalf("expected ErrMatcherStarted, got %v", err)
+	}
 
-	// 进程退出
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, os.Interrupt)
 	for {
 		select {
 		// 模拟消费 room
@@ -105,27 +144,267 @@ func Test_Matcher(t *testing.T) {
 			}
 			fmt.Println("-------------------------------------------------------------------")
 			fmt.Println()
-		case <-ch:
-			gs1, gs2 := qm.Stop()
+		case res := <-resultChan:
+			fmt.Printf("| %s matched a room, team mmr spread: %.2f, star spread: %d, match range stage: %d, hasAi: %t\n",
+				res.QueueName, res.TeamMMRSpread, res.StarSpread, res.MatchRangeStage, res.HasAi)
+			fmt.Println()
+		case <-ctx.Done():
+			left := qm.Stop()
+			if len(qm.Stop()) != 0 {
+				t.Fatal("expected repeated Stop to return nothing")
+			}
 
 			fmt.Println()
 			fmt.Println()
 			fmt.Println("--------------- finish --------------")
 
-			fmt.Println("normal queue left group count:", len(gs1))
-			fmt.Printf("\t\tGroupId\t\t\tPlayerCount\t\tmmr\t\tAvgMMR\t\tMatchTime\t\t\n")
-			for _, g := range gs1 {
-				g.Print()
-			}
-			fmt.Println()
-			fmt.Println("team queue left group count:", len(gs2))
-			fmt.Printf("\t\tGroupId\t\t\tPlayerCount\t\tmmr\t\tAvgMMR\t\tMatchTime\t\t\n")
-			for _, g := range gs2 {
-				g.Print()
+			for _, q := range qm.Queues() {
+				fmt.Printf("%s left group count: %d\n", q.Name, len(left[q.Name]))
+				fmt.Printf("\t\tGroupId\t\t\tPlayerCount\t\tmmr\t\tAvgMMR\t\tMatchTime\t\t\n")
+				for _, g := range left[q.Name] {
+					g.Print()
+				}
+				fmt.Println()
 			}
 			return
 		default:
-			time.Sleep(100 * time.Millisecond)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func Test_MatcherDrain(t *testing.T) {
+	roomChan := make(chan glicko2.Room, 128)
+	resultChan := make(chan glicko2.MatchResult, 128)
+	counter := &countObserver{}
+	qm := glicko2.NewMatcher(roomChan, glicko2.MatcherArgs{
+		ResultChan: resultChan,
+		Observers:  []glicko2.MatcherObserver{counter},
+		QueueArgs: glicko2.QueueArgs{
+			RoomPlayerLimit: RoomPlayerLimit,
+			TeamPlayerLimit: TeamPlayerLimit,
+			RoomTeamLimit:   RoomTeamLimit,
+		},
+	}, NewTeam, NewRoom, NewRoomWithAi)
+
+	for i := 0; i < RoomPlayerLimit; i++ {
+		p := NewPlayer(fmt.Sprintf("player-%d", i+1), false, 0, glicko2.Args{MMR: 1500, DR: 200, V: 0.06})
+		if err := qm.AddGroups(NewGroup(fmt.Sprintf("group-%d", i+1), []glicko2.Player{p})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := qm.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := qm.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := qm.AddGroups(NewGroup("late", nil)); err != glicko2.ErrMatcherNotAccepting {
+		t.Fatalf("expected ErrMatcherNotAccepting, got %v", err)
+	}
+	select {
+	case room := <-roomChan:
+		if room.PlayerCount() != RoomPlayerLimit {
+			t.Fatalf("expected a full room, got %d players", room.PlayerCount())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a matched room")
+	}
+	select {
+	case res := <-resultChan:
+		if res.QueueName != glicko2.NormalQueue || len(res.GroupWaitSec) != RoomPlayerLimit ||
+			res.TeamMMRSpread != 0 || res.HasAi || res.MatchRangeStage != -1 {
+			t.Fatalf("unexpected match result: %+v", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a match result")
+	}
+	if counter.enqueued.Load() != RoomPlayerLimit || counter.teams.Load() != RoomTeamLimit ||
+		counter.rooms.Load() != 1 || counter.emitted.Load() != 1 {
+		t.Fatalf("unexpected events: enqueued %d, teams %d, rooms %d, emitted %d", counter.enqueued.Load(),
+			counter.teams.Load(), counter.rooms.Load(), counter.emitted.Load())
+	}
+	for name, gs := range qm.Stop() {
+		if len(gs) != 0 {
+			t.Fatalf("expected %s to be empty, got %d groups", name, len(gs))
 		}
 	}
 }
+
+func Test_MatcherTrigger(t *testing.T) {
+	roomChan := make(chan glicko2.Room, 128)
+	qm := glicko2.NewMatcher(roomChan, glicko2.MatcherArgs{
+		TickInterval: time.Hour,
+		QueueArgs: glicko2.QueueArgs{
+			RoomPlayerLimit:    RoomPlayerLimit,
+			TeamPlayerLimit:    TeamPlayerLimit,
+			RoomTeamLimit:      RoomTeamLimit,
+			TriggerPlayerCount: RoomPlayerLimit,
+		},
+	}, NewTeam, NewRoom, NewRoomWithAi)
+	if err := qm.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer qm.Stop()
+
+	for i := 0; i < RoomPlayerLimit; i++ {
+		p := NewPlayer(fmt.Sprintf("player-%d", i+1), false, 0, glicko2.Args{MMR: 1500, DR: 200, V: 0.06})
+		if err := qm.AddGroups(NewGroup(fmt.Sprintf("group-%d", i+1), []glicko2.Player{p})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-roomChan:
+	case <-time.After(time.Second):
+		t.Fatal("expected the trigger to start a matching round before the next tick")
+	}
+}
+
+func Test_MatcherCancelGroup(t *testing.T) {
+	roomChan := make(chan glicko2.Room, 128)
+	qm := glicko2.NewMatcher(roomChan, glicko2.MatcherArgs{
+		TickInterval: 50 * time.Millisecond,
+		QueueArgs: glicko2.QueueArgs{
+			RoomPlayerLimit: RoomPlayerLimit,
+			TeamPlayerLimit: TeamPlayerLimit,
+			RoomTeamLimit:   RoomTeamLimit,
+		},
+	}, NewTeam, NewRoom, NewRoomWithAi)
+
+	groups := make([]glicko2.Group, 0, TeamPlayerLimit-1)
+	for i := 0; i < TeamPlayerLimit-1; i++ {
+		p := NewPlayer(fmt.Sprintf("player-%d", i+1), false, 0, glicko2.Args{MMR: 1500, DR: 200, V: 0.06})
+		groups = append(groups, NewGroup(fmt.Sprintf("group-%d", i+1), []glicko2.Player{p}))
+	}
+	if err := qm.AddGroups(groups...); err != nil {
+		t.Fatal(err)
+	}
+	if err := qm.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 等待几轮匹配，让队伍进入临时阵营
+	time.Sleep(200 * time.Millisecond)
+	if !qm.CancelGroup("group-1", glicko2.CancelMatchByUser) {
+		t.Fatal("expected group-1 to be found")
+	}
+	if qm.CancelGroup("group-1", glicko2.CancelMatchByUser) {
+		t.Fatal("expected group-1 to be removed")
+	}
+	if groups[0].GetState() != glicko2.GroupStateUnready {
+		t.Fatalf("expected cancelled group to be unready, got %d", groups[0].GetState())
+	}
+
+	if left := qm.Stop(); len(left[glicko2.NormalQueue]) != len(groups)-1 {
+		t.Fatalf("expected %d groups left, got %d", len(groups)-1, len(left[glicko2.NormalQueue]))
+	}
+}
+
+func Test_MatcherCustomQueues(t *testing.T) {
+	queueArgs := glicko2.QueueArgs{
+		RoomPlayerLimit: RoomPlayerLimit,
+		TeamPlayerLimit: TeamPlayerLimit,
+		RoomTeamLimit:   RoomTeamLimit,
+	}
+	isHighMMR := func(g glicko2.Group) bool {
+		return g.MMR() >= 2500
+	}
+
+	roomChan := make(chan glicko2.Room, 128)
+	qm := glicko2.NewMatcher(roomChan, glicko2.MatcherArgs{
+		TickInterval: 50 * time.Millisecond,
+		Queues: []glicko2.QueueConfig{
+			{Name: "solo", Args: queueArgs},
+			{Name: "high", Args: queueArgs},
+		},
+		Router: glicko2.RoutingPolicy{
+			Routes: []glicko2.RouteRule{
+				{Queue: "high", Match: isHighMMR},
+				{Queue: "solo", Match: glicko2.GroupTypeIs(glicko2.GroupTypeNotTeam)},
+			},
+			Promotions: []glicko2.PromoteRule{
+				{From: "high", To: "solo", WaitTimeSec: 0},
+			},
+		},
+	}, NewTeam, NewRoom, NewRoomWithAi)
+
+	// 5 人车队没有可以进入的队列
+	team := make([]glicko2.Player, 0, TeamPlayerLimit)
+	for i := 0; i < TeamPlayerLimit; i++ {
+		team = append(team, NewPlayer(fmt.Sprintf("team-player-%d", i+1), false, 0, glicko2.Args{MMR: 1500}))
+	}
+	if err := qm.AddGroups(NewGroup("team", team)); !errors.Is(err, glicko2.ErrQueueNotFound) {
+		t.Fatalf("expected ErrQueueNotFound, got %v", err)
+	}
+
+	high := NewGroup("high", []glicko2.Player{NewPlayer("high", false, 0, glicko2.Args{MMR: 3000})})
+	if err := qm.AddGroups(high); err != nil {
+		t.Fatal(err)
+	}
+	if err := qm.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 高分队伍在 high 队列的临时阵营被打散后移动到 solo 队列
+	time.Sleep(500 * time.Millisecond)
+	left := qm.Stop()
+	if len(left["high"]) != 0 || len(left["solo"]) != 1 || left["solo"][0] != high {
+		t.Fatalf("expected the high group to be promoted to solo, got %v", left)
+	}
+}
+
+// reentrantObserver 在事件中回调队列查询状态
+type reentrantObserver struct {
+	glicko2.NopObserver
+	matcher  *glicko2.Matcher
+	enqueued chan int
+	timeout  chan int
+}
+
+func (o *reentrantObserver) OnGroupEnqueued(queue string, _ glicko2.Group) {
+	// State 和 PlayerCount 分别需要 Matcher 和 Queue 的锁
+	if o.matcher.State() == glicko2.MatcherStateIdle {
+		o.enqueued <- o.matcher.Queue(queue).PlayerCount()
+	}
+}
+
+func (o *reentrantObserver) OnGroupTimeout(queue string, _ glicko2.Group) {
+	o.timeout <- len(o.matcher.Queue(queue).AllGroups())
+}
+
+func Test_MatcherObserverReentrant(t *testing.T) {
+	observer := &reentrantObserver{enqueued: make(chan int, 1), timeout: make(chan int, 1)}
+	observer.matcher = glicko2.NewMatcher(make(chan glicko2.Room, 1), glicko2.MatcherArgs{
+		TickInterval: 10 * time.Millisecond,
+		QueueArgs: glicko2.QueueArgs{
+			RoomPlayerLimit: RoomPlayerLimit,
+			TeamPlayerLimit: TeamPlayerLimit,
+			RoomTeamLimit:   RoomTeamLimit,
+			MatchTimeoutSec: 1,
+		},
+		Observers: []glicko2.MatcherObserver{observer},
+	}, NewTeam, NewRoom, NewRoomWithAi)
+	defer observer.matcher.Stop()
+
+	// 已经等待了 10 秒的队伍，下一轮匹配时超时
+	group := NewGroup("group", []glicko2.Player{NewPlayer("player", false, 0, glicko2.Args{MMR: 1500, DR: 200, V: 0.06})})
+	group.SetStartMatchTimeSec(time.Now().Unix() - 10)
+	if err := observer.matcher.AddGroups(group); err != nil {
+		t.Fatal(err)
+	}
+	if count := <-observer.enqueued; count != 1 {
+		t.Fatalf("expected 1 player in the queue, got %d", count)
+	}
+	if err := observer.matcher.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-observer.timeout:
+	case <-time.After(time.Second):
+		t.Fatal("expected the group to time out without deadlocking")
+	}
+}
@@ -0,0 +1,58 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hedon954/glicko2-matcher"
+)
+
+func Test_Metrics(t *testing.T) {
+	metrics := glicko2.NewMetrics()
+	roomChan := make(chan glicko2.Room, 128)
+	qm := glicko2.NewMatcher(roomChan, glicko2.MatcherArgs{
+		TickInterval: 50 * time.Millisecond,
+		QueueArgs: glicko2.QueueArgs{
+			RoomPlayerLimit: RoomPlayerLimit,
+			TeamPlayerLimit: TeamPlayerLimit,
+			RoomTeamLimit:   RoomTeamLimit,
+		},
+		Observers: []glicko2.MatcherObserver{metrics},
+	}, NewTeam, NewRoom, NewRoomWithAi)
+
+	// 16 个单排玩家，组成 1 个房间后剩下 1 个
+	for i := 0; i < RoomPlayerLimit+1; i++ {
+		p := NewPlayer(fmt.Sprintf("player-%d", i+1), false, 0, glicko2.Args{MMR: 1500, DR: 200, V: 0.06})
+		if err := qm.AddGroups(NewGroup(fmt.Sprintf("group-%d", i+1), []glicko2.Player{p})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := qm.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-roomChan
+	time.Sleep(100 * time.Millisecond)
+	qm.Stop()
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, line := range []string{
+		"# TYPE glicko2_queue_tmp_teams gauge",
+		`glicko2_groups_enqueued_total{queue="NormalQueue"} 16`,
+		`glicko2_rooms_total{queue="NormalQueue"} 1`,
+		`glicko2_ai_fill_ratio{queue="NormalQueue"} 0`,
+		`glicko2_queue_tmp_teams{queue="NormalQueue"}`,
+		`glicko2_match_wait_seconds_count{queue="NormalQueue"} 15`,
+		`glicko2_round_duration_seconds_bucket{queue="NormalQueue",le="+Inf"}`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Fatalf("expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+}
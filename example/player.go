@@ -23,8 +23,22 @@ type Player struct {
 	rank int
 	star int
 
+	performance    float64
+	hasPerformance bool
+
+	participation glicko2.Participation
+	share         float64
+
+	ladderState glicko2.LadderState
+	streak      int
+
+	placementGames       int
+	playedPlacementGames int
+	placementMMR         float64
+
 	startMatchTime  int64
 	finishMatchTime int64
+	ratedTime       int64
 
 	*glicko.Player
 }
@@ -34,7 +48,7 @@ func NewPlayer(id string, isAi bool, aiLevel int64, args glicko2.Args) glicko2.P
 	TODO:
 	算法刚启动的时候，会手动配置不同段位的补偿分数，把各个段位的分数人工区分初始化玩家的 mmr，rd 和 v，
 
-		赛季重置也会初始化玩家的相关分数，重置方式如下；
+		赛季重置也会初始化玩家的相关分数（见 glicko2.SeasonReset 的默认规则），重置方式如下；
 	1. 初始评分（mmr），转换为上赛季评分*70%，最低分1000，最高分7500
 	2. RD，根据当前赛季和历史最高赛季的星星数差距决定，最高700，最低为0
 	3. 波动率，初始为0.06
@@ -97,9 +111,9 @@ func (p *Player) GetArgs() *glicko2.Args {
 	p.RLock()
 	defer p.RUnlock()
 	/**
-	TODO:
 	赛季初始 5 局过后，mmr 分数开始生效；生效前沿用上赛季分数进行匹配。
 	新玩家和回流玩家会进入保护期，分数不计算，对局全部按照最低分进行匹配，直到完成10次团战对局，开始使用真实分数进行匹配。
+	见 StartPlacement 和 glicko2.PlacementPlayer。
 	*/
 	return &glicko2.Args{
 		MMR: p.mmr,
@@ -136,3 +150,85 @@ func (p *Player) Rank() int {
 func (p *Player) SetRank(rank int) {
 	p.rank = rank
 }
+
+func (p *Player) Performance() (float64, bool) {
+	return p.performance, p.hasPerformance
+}
+
+func (p *Player) SetPerformance(performance float64) {
+	p.performance = performance
+	p.hasPerformance = true
+}
+
+func (p *Player) GetRatedTimeSec() int64 {
+	p.RLock()
+	defer p.RUnlock()
+	return p.ratedTime
+}
+
+func (p *Player) SetRatedTimeSec(t int64) {
+	p.Lock()
+	defer p.Unlock()
+	p.ratedTime = t
+}
+
+func (p *Player) Participation() (glicko2.Participation, float64) {
+	return p.participation, p.share
+}
+
+func (p *Player) SetParticipation(participation glicko2.Participation, share float64) {
+	p.participation = participation
+	p.share = share
+}
+
+func (p *Player) GetLadderState() glicko2.LadderState {
+	return p.ladderState
+}
+
+func (p *Player) SetLadderState(state glicko2.LadderState) {
+	p.ladderState = state
+}
+
+func (p *Player) GetStreak() int {
+	p.RLock()
+	defer p.RUnlock()
+	return p.streak
+}
+
+func (p *Player) SetStreak(streak int) {
+	p.Lock()
+	defer p.Unlock()
+	p.streak = streak
+}
+
+func (p *Player) StartPlacement(games int, mmr float64) {
+	p.Lock()
+	defer p.Unlock()
+	p.placementGames = games
+	p.playedPlacementGames = 0
+	p.placementMMR = mmr
+}
+
+func (p *Player) PlacementGames() int {
+	p.RLock()
+	defer p.RUnlock()
+	return p.placementGames
+}
+
+func (p *Player) GetPlayedPlacementGames() int {
+	p.RLock()
+	defer p.RUnlock()
+	return p.playedPlacementGames
+}
+
+func (p *Player) SetPlayedPlacementGames(games int) {
+	p.Lock()
+	defer p.Unlock()
+	p.playedPlacementGames = games
+}
+
+func (p *Player) PlacementMMR() float64 {
+	p.RLock()
+	defer p.RUnlock()
+	return p.placementMMR
+}
@@ -0,0 +1,85 @@
+package example
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/hedon954/glicko2-matcher"
+)
+
+func newRatedTeam(name string, args ...glicko2.Args) glicko2.Team {
+	team := NewTeam()
+	group := NewGroup(name, nil)
+	group.SetState(glicko2.GroupStateQueuing)
+	for i, a := range args {
+		group.AddPlayers(NewPlayer(fmt.Sprintf("%s-player-%d", name, i+1), false, 0, a))
+	}
+	team.AddGroup(group)
+	return team
+}
+
+func Test_MatchQuality(t *testing.T) {
+	even := NewRoom()
+	even.AddTeam(newRatedTeam("a", glicko2.Args{MMR: 1500, DR: 100}, glicko2.Args{MMR: 1600, DR: 100}))
+	even.AddTeam(newRatedTeam("b", glicko2.Args{MMR: 1550, DR: 100}, glicko2.Args{MMR: 1550, DR: 100}))
+	if q := glicko2.MatchQuality(even); math.Abs(q.FavoriteExpected-0.5) > 1e-9 {
+		t.Fatalf("expected an even room, got %+v", q)
+	}
+
+	certain := NewRoom()
+	certain.AddTeam(newRatedTeam("a", glicko2.Args{MMR: 1500, DR: 30}))
+	certain.AddTeam(newRatedTeam("b", glicko2.Args{MMR: 1800, DR: 30}))
+	cq := glicko2.MatchQuality(certain)
+	if cq.Favorite != 1 || cq.FavoriteExpected < 0.8 {
+		t.Fatalf("expected team b to be a clear favorite, got %+v", cq)
+	}
+
+	// 评分偏差越大，期望得分越接近 0.5
+	uncertain := NewRoom()
+	uncertain.AddTeam(newRatedTeam("a", glicko2.Args{MMR: 1500, DR: 350}))
+	uncertain.AddTeam(newRatedTeam("b", glicko2.Args{MMR: 1800, DR: 350}))
+	if uq := glicko2.MatchQuality(uncertain); uq.Favorite != 1 || uq.FavoriteExpected >= cq.FavoriteExpected {
+		t.Fatalf("expected rating deviation to lower the favorite's expectation, got %+v", uq)
+	}
+}
+
+func Test_MatchQualityGate(t *testing.T) {
+	args := glicko2.QueueArgs{
+		MatchRanges: []glicko2.MatchRange{
+			{MaxMatchSec: 3600, MMRGapPercent: 10, MaxWinProbability: 0.6},
+		},
+	}
+	groups := func() []glicko2.Group {
+		return []glicko2.Group{
+			newQueuedGroup("a", glicko2.Args{MMR: 1500, DR: 30}),
+			newQueuedGroup("b", glicko2.Args{MMR: 1600, DR: 30}),
+		}
+	}
+
+	// mmr 差距在 10% 以内，但 b 的期望胜率约为 0.64
+	if rooms := matchSoloRooms(args, groups()...); len(rooms) != 0 {
+		t.Fatalf("expected the win probability gate to keep a and b apart, got %v", rooms)
+	}
+
+	args.MatchRanges[0].MaxWinProbability = 0.7
+	if rooms := matchSoloRooms(args, groups()...); len(rooms) != 1 {
+		t.Fatalf("expected a and b to be matched under a looser gate, got %v", rooms)
+	}
+}
+
+func Test_MatchQualityPlacement(t *testing.T) {
+	args := glicko2.QueueArgs{
+		MatchRanges: []glicko2.MatchRange{
+			{MaxMatchSec: 3600, MMRGapPercent: 10, MaxWinProbability: 0.6},
+		},
+	}
+
+	// 定级期间按 PlacementMMR 1600 计算胜率，与 b 势均力敌
+	a := newQueuedGroup("a", glicko2.Args{MMR: 1500, DR: 30})
+	a.Players()[0].(*Player).StartPlacement(5, 1600)
+	b := newQueuedGroup("b", glicko2.Args{MMR: 1600, DR: 30})
+	if rooms := matchSoloRooms(args, a, b); len(rooms) != 1 {
+		t.Fatalf("expected the placement mmr to be used for the win probability gate, got %v", rooms)
+	}
+}
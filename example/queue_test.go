@@ -0,0 +1,111 @@
+package example
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hedon954/glicko2-matcher"
+)
+
+func Test_QueueGetMatchRange(t *testing.T) {
+	ranges := []glicko2.MatchRange{
+		{MaxMatchSec: 5, MMRGapPercent: 10},
+		{MaxMatchSec: 15, MMRGapPercent: 20},
+		{MaxMatchSec: 30, MMRGapPercent: 0},
+	}
+	q := glicko2.NewQueue("test", nil, glicko2.QueueArgs{MatchRanges: ranges}, NewTeam, NewRoom, NewRoomWithAi)
+
+	// 以等待时间短的一方为准
+	now := time.Now().Unix()
+	cases := []struct {
+		mst1, mst2 int64
+		expected   glicko2.MatchRange
+	}{
+		{now - 1, now - 20, ranges[0]},
+		{now - 20, now - 10, ranges[1]},
+		{now - 40, now - 20, ranges[2]},
+		{now - 100, now - 100, ranges[2]},
+	}
+	for _, c := range cases {
+		if mr := q.GetMatchRange(c.mst1, c.mst2); mr != c.expected {
+			t.Fatalf("expected %+v for waits of %ds and %ds, got %+v", c.expected, now-c.mst1, now-c.mst2, mr)
+		}
+	}
+}
+
+// newQueuedGroup 构建一个刚开始匹配的单人队伍
+func newQueuedGroup(id string, args glicko2.Args) glicko2.Group {
+	group := NewGroup(id, []glicko2.Player{NewPlayer(id, false, 0, args)})
+	group.SetState(glicko2.GroupStateQueuing)
+	group.SetStartMatchTimeSec(time.Now().Unix())
+	return group
+}
+
+// matchSoloRooms 以每个阵营 1 人、每个房间 2 个阵营进行一轮贪心匹配，返回组成的房间中的队伍 ID
+func matchSoloRooms(args glicko2.QueueArgs, groups ...glicko2.Group) [][]string {
+	args.RoomPlayerLimit, args.TeamPlayerLimit, args.RoomTeamLimit = 2, 1, 2
+	q := glicko2.NewQueue("test", nil, args, NewTeam, NewRoom, NewRoomWithAi)
+	rooms, _ := glicko2.GreedyStrategy{}.Match(q, glicko2.MatchState{Groups: groups})
+
+	res := make([][]string, 0, len(rooms))
+	for _, room := range rooms {
+		ids := make([]string, 0, 2)
+		for _, team := range room.Teams() {
+			for _, g := range team.Groups() {
+				ids = append(ids, g.ID())
+			}
+		}
+		sort.Strings(ids)
+		res = append(res, ids)
+	}
+	return res
+}
+
+func Test_QueueUncertainWait(t *testing.T) {
+	args := glicko2.QueueArgs{
+		MatchRanges: []glicko2.MatchRange{
+			{MaxMatchSec: 10, MMRGapPercent: 5},
+			{MaxMatchSec: 3600, MMRGapPercent: 20},
+		},
+		UncertainDR:      300,
+		UncertainWaitSec: 10,
+	}
+
+	// 两对玩家的 mmr 差距都是 10%，只有评分偏差高的一对视为已经匹配了 10 秒，使用 20% 的匹配范围
+	rooms := matchSoloRooms(args,
+		newQueuedGroup("certain-1", glicko2.Args{MMR: 1500, DR: 50}),
+		newQueuedGroup("certain-2", glicko2.Args{MMR: 1650, DR: 50}),
+		newQueuedGroup("uncertain-1", glicko2.Args{MMR: 3000, DR: 350}),
+		newQueuedGroup("uncertain-2", glicko2.Args{MMR: 3300, DR: 350}),
+	)
+	if len(rooms) != 1 || rooms[0][0] != "uncertain-1" || rooms[0][1] != "uncertain-2" {
+		t.Fatalf("expected only the uncertain players to be matched, got %v", rooms)
+	}
+}
+
+func Test_QueueLosingStreakWait(t *testing.T) {
+	args := glicko2.QueueArgs{
+		MatchRanges: []glicko2.MatchRange{
+			{MaxMatchSec: 10, MMRGapPercent: 5},
+			{MaxMatchSec: 3600, MMRGapPercent: 20},
+		},
+		LosingStreak:        3,
+		LosingStreakWaitSec: 10,
+	}
+
+	// 两对玩家的 mmr 差距都是 10%，只有连败 3 局的一对视为已经匹配了 10 秒，使用 20% 的匹配范围
+	groups := []glicko2.Group{
+		newQueuedGroup("normal-1", glicko2.Args{MMR: 1500, DR: 50}),
+		newQueuedGroup("normal-2", glicko2.Args{MMR: 1650, DR: 50}),
+		newQueuedGroup("losing-1", glicko2.Args{MMR: 3000, DR: 50}),
+		newQueuedGroup("losing-2", glicko2.Args{MMR: 3300, DR: 50}),
+	}
+	for _, g := range groups[2:] {
+		g.Players()[0].(*Player).SetStreak(-3)
+	}
+	rooms := matchSoloRooms(args, groups...)
+	if len(rooms) != 1 || rooms[0][0] != "losing-1" || rooms[0][1] != "losing-2" {
+		t.Fatalf("expected only the players on a losing streak to be matched, got %v", rooms)
+	}
+}
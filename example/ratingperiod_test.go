@@ -0,0 +1,135 @@
+package example
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/hedon954/glicko2-matcher"
+)
+
+func Test_RatingPeriodManager(t *testing.T) {
+	flushed := 0
+	manager := glicko2.NewRatingPeriodManager(glicko2.NewSettler(glicko2.SettlerArgs{}), glicko2.RatingPeriodArgs{
+		MaxGamesPerPlayer: 2,
+		OnFlush: func(report *glicko2.SettlementReport) {
+			flushed++
+		},
+	})
+	room, players := newSettleRoom([]int{1, 2}, []int{1, 2})
+	winner := players[0][0]
+
+	// 第一局只有临时结算结果，玩家的参数不变
+	report := manager.AddRoom(room)
+	if winner.GetArgs().MMR != 1500 || flushed != 0 {
+		t.Fatalf("expected args to stay unchanged before flush, got %+v", winner.GetArgs())
+	}
+	first, ok := manager.Provisional(winner.ID())
+	if !ok || first.Delta.MMR <= 0 || first != report.Players[0] {
+		t.Fatalf("unexpected provisional settlement: %+v", first)
+	}
+
+	// 第二局达到 MaxGamesPerPlayer，结束计算周期，两局在同一个周期内计算
+	report = manager.AddRoom(room)
+	if flushed != 1 {
+		t.Fatalf("expected the period to be flushed once, got %d", flushed)
+	}
+	second := report.Players[0]
+	if second.Before.MMR != 1500 || second.Opponents != 2*first.Opponents || second.Delta.MMR <= first.Delta.MMR {
+		t.Fatalf("unexpected settlement for the period: %+v", second)
+	}
+	if winner.GetArgs().MMR != second.After.MMR {
+		t.Fatalf("expected args %+v, got %+v", second.After, winner.GetArgs())
+	}
+	if _, ok := manager.Provisional(winner.ID()); ok {
+		t.Fatal("expected no provisional settlement after flush")
+	}
+}
+
+func Test_RatingPeriodManagerIdempotent(t *testing.T) {
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{Store: glicko2.NewMemorySettlementStore()})
+	manager := glicko2.NewRatingPeriodManager(settler, glicko2.RatingPeriodArgs{})
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	room.(*Room).SetID(1)
+	winner := players[0][0]
+
+	// 游戏服务器重试投递同一个房间，只计入一次
+	first := manager.AddRoom(room)
+	retried := manager.AddRoom(room)
+	if first.Duplicate || !retried.Duplicate || retried.Players[0] != first.Players[0] {
+		t.Fatalf("expected the retried room to return the earlier report, got %+v", retried)
+	}
+	provisional, _ := manager.Provisional(winner.ID())
+	if provisional.Opponents != 1 || provisional != first.Players[0] {
+		t.Fatalf("expected the room to be counted once, got %+v", provisional)
+	}
+
+	// 已经加入计算周期的房间也不会再被 UpdateMMR 结算
+	if report := settler.UpdateMMR(room); !report.Duplicate {
+		t.Fatalf("expected the room to be settled already, got %+v", report)
+	}
+	if report := settler.ForceUpdateMMR(room); len(report.Errors) != 1 || !errors.Is(report.Errors[0], glicko2.ErrRoomInRatingPeriod) {
+		t.Fatalf("expected ErrRoomInRatingPeriod, got %+v", report.Errors)
+	}
+	report := manager.Flush()
+	if len(report.Players) != 2 || report.Players[0].Opponents != 1 {
+		t.Fatalf("unexpected period settlement: %+v", report.Players)
+	}
+}
+
+func Test_RatingPeriodManagerRollback(t *testing.T) {
+	// 只有第二局的计算周期的结果
+	only, expected := newSettleRoom([]int{2, 1}, []int{1})
+	glicko2.NewRatingPeriodManager(new(glicko2.Settler), glicko2.RatingPeriodArgs{MaxGamesPerPlayer: 1}).AddRoom(only)
+
+	for _, policy := range []glicko2.RollbackPolicy{glicko2.RollbackPolicyRecompute, glicko2.RollbackPolicyInverseDelta} {
+		settler := glicko2.NewSettler(glicko2.SettlerArgs{Journal: glicko2.NewMemoryJournal()})
+		manager := glicko2.NewRatingPeriodManager(settler, glicko2.RatingPeriodArgs{})
+		room, players := newSettleRoom([]int{1, 2}, []int{1})
+		teams := append([]glicko2.Team(nil), room.Teams()...)
+		all := []glicko2.Player{players[0][0], players[1][0]}
+
+		// 同一个计算周期内先后进行两局，第一局 team-1 获胜，第二局 team-2 获胜
+		room.(*Room).SetID(1)
+		manager.AddRoom(room)
+		room.(*Room).SetID(2)
+		teams[0].SetRank(2)
+		teams[1].SetRank(1)
+		manager.AddRoom(room)
+		manager.Flush()
+
+		// 撤销第一局后与计算周期内只有第二局的结果相同
+		report, err := settler.Rollback(1, all, policy)
+		if err != nil || len(report.Players) != 2 || len(report.Errors) != 0 {
+			t.Fatalf("unexpected rollback with policy %d: %+v, %v", policy, report, err)
+		}
+		for i, p := range all {
+			got, want := *p.GetArgs(), *expected[i][0].GetArgs()
+			if math.Abs(got.MMR-want.MMR) > 1e-9 || math.Abs(got.DR-want.DR) > 1e-9 || math.Abs(got.V-want.V) > 1e-9 {
+				t.Fatalf("expected %+v after rollback with policy %d, got %+v", want, policy, got)
+			}
+		}
+	}
+}
+
+func Test_RatingPeriodManagerOutsideChange(t *testing.T) {
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{Journal: glicko2.NewMemoryJournal()})
+	manager := glicko2.NewRatingPeriodManager(settler, glicko2.RatingPeriodArgs{})
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	all := []glicko2.Player{players[0][0], players[1][0]}
+	winner := all[0]
+
+	room.(*Room).SetID(1)
+	settler.UpdateMMR(room)
+	room.(*Room).SetID(2)
+	provisional := manager.AddRoom(room).Players[0]
+
+	// 计算周期结束前撤销第一局，周期的变化加在撤销后的参数上
+	if _, err := settler.Rollback(1, all, glicko2.RollbackPolicyInverseDelta); err != nil {
+		t.Fatal(err)
+	}
+	report := manager.Flush()
+	if got, want := winner.GetArgs().MMR, 1500+provisional.Delta.MMR; math.Abs(got-want) > 1e-9 || report.Players[0].Before.MMR != 1500 {
+		t.Fatalf("expected mmr %0.4f after flush, got %0.4f", want, got)
+	}
+}
@@ -0,0 +1,93 @@
+package example
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hedon954/glicko2-matcher"
+)
+
+// memoryStore 是内存中的玩家赛季数据，像数据库游标一样不允许在遍历期间写入
+type memoryStore struct {
+	records []glicko2.SeasonRecord
+	saved   map[string]glicko2.SeasonRecord
+	ranging bool
+}
+
+func (s *memoryStore) Range(fn func(rec glicko2.SeasonRecord) error) error {
+	s.ranging = true
+	defer func() { s.ranging = false }()
+	for _, rec := range s.records {
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Save(rec glicko2.SeasonRecord) error {
+	if s.ranging {
+		return errors.New("save during range")
+	}
+	if rec.PlayerID == "broken" {
+		return errors.New("broken record")
+	}
+	s.saved[rec.PlayerID] = rec
+	return nil
+}
+
+func Test_SeasonReset(t *testing.T) {
+	reset := glicko2.NewSeasonReset(glicko2.SeasonResetArgs{StarRatio: 0.5})
+	store := &memoryStore{
+		records: []glicko2.SeasonRecord{
+			{PlayerID: "low", Args: glicko2.Args{MMR: 1200, DR: 50, V: 0.08}, Star: 10, BestStar: 30},
+			{PlayerID: "high", Args: glicko2.Args{MMR: 12000, DR: 50, V: 0.05}, Star: 101, BestStar: 20},
+			{PlayerID: "broken", Args: glicko2.Args{MMR: 3000, DR: 50, V: 0.06}, Star: 0, BestStar: 100},
+		},
+		saved: make(map[string]glicko2.SeasonRecord),
+	}
+
+	// 试运行只统计分布，不保存
+	report, err := reset.Run(store, true)
+	if err != nil || len(store.saved) != 0 {
+		t.Fatalf("expected a dry run without saving, got %v and %d saved", err, len(store.saved))
+	}
+	if report.Before.MMR.Max != 12000 || report.After.MMR.Max != 7500 || report.After.Players != 3 {
+		t.Fatalf("unexpected distribution: %+v", report)
+	}
+
+	report, err = reset.Run(store, false)
+	if err != nil || len(report.Errors) != 1 {
+		t.Fatalf("expected one save error, got %v and %v", err, report.Errors)
+	}
+	expected := map[string]glicko2.SeasonRecord{
+		// mmr 1200*0.7 不低于 1000，rd 为星数差距 20*10
+		"low": {PlayerID: "low", Args: glicko2.Args{MMR: 1000, DR: 200, V: 0.06}, Star: 5, BestStar: 30},
+		// mmr 不高于 7500，历史最高星数更新为 101
+		"high": {PlayerID: "high", Args: glicko2.Args{MMR: 7500, DR: 0, V: 0.06}, Star: 50, BestStar: 101},
+	}
+	for id, rec := range expected {
+		if store.saved[id] != rec {
+			t.Fatalf("expected %+v, got %+v", rec, store.saved[id])
+		}
+	}
+	// 星数差距 100 时 rd 不高于 700
+	if rec := reset.Reset(store.records[2]); rec.Args.DR != 700 || rec.Args.MMR != 2100 {
+		t.Fatalf("unexpected reset record: %+v", rec)
+	}
+}
+
+func Test_SeasonResetPlacement(t *testing.T) {
+	reset := glicko2.NewSeasonReset(glicko2.SeasonResetArgs{PlacementGames: 5})
+	rec := reset.Reset(glicko2.SeasonRecord{PlayerID: "player", Args: glicko2.Args{MMR: 3000, DR: 50, V: 0.06}})
+	if rec.PlacementGames != 5 || rec.PlacementMMR != 3000 {
+		t.Fatalf("expected 5 placement games at last season's mmr, got %+v", rec)
+	}
+
+	// 新赛季前 5 局按上赛季的 mmr 匹配
+	player := NewPlayer(rec.PlayerID, false, 0, rec.Args)
+	rec.StartPlacement(player)
+	if !glicko2.InPlacement(player) || glicko2.MatchingMMR(player) != 3000 || player.GetArgs().MMR != 2100 {
+		t.Fatalf("expected the player to be matched at 3000 during placement, got %0.2f", glicko2.MatchingMMR(player))
+	}
+}
@@ -1,36 +1,632 @@
 package example
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/hedon954/glicko2-matcher"
 )
 
-func Test_Settler(t *testing.T) {
-	settler := new(glicko2.Settler)
+// newSettleRoom 构建一个待结算的房间，阵营和阵营内玩家的排名分别为 teamRanks 和 playerRanks
+func newSettleRoom(teamRanks, playerRanks []int) (glicko2.Room, [][]glicko2.Player) {
 	room := NewRoom()
-	for i := 0; i < 3; i++ {
+	players := make([][]glicko2.Player, len(teamRanks))
+	for i, teamRank := range teamRanks {
 		team := NewTeam()
-		team.SetRank(i + 1)
+		team.SetRank(teamRank)
 		group := NewGroup(fmt.Sprintf("team-%d-group", i+1), nil)
 		group.SetState(glicko2.GroupStateQueuing)
-		for j := 0; j < 5; j++ {
+		for j, playerRank := range playerRanks {
 			player := NewPlayer(fmt.Sprintf("team-%d-player-%d", i+1, j+1), false, 0, glicko2.Args{
 				MMR: 1500,
 				DR:  200,
 				V:   0.06,
 			})
-			player.SetRank(j + 1)
+			player.SetRank(playerRank)
 			group.AddPlayers(player)
+			players[i] = append(players[i], player)
 		}
 		team.AddGroup(group)
 		room.AddTeam(team)
 	}
+	return room, players
+}
+
+func Test_Settler(t *testing.T) {
+	settler := new(glicko2.Settler)
+	room, _ := newSettleRoom([]int{1, 2, 3}, []int{1, 2, 3, 4, 5})
 
 	for i := 0; i < 10; i++ {
-		settler.UpdateMMR(room)
-		fmt.Println()
+		report := settler.UpdateMMR(room)
+		if len(report.Errors) != 0 {
+			t.Fatal(report.Errors)
+		}
+		for _, ps := range report.Players {
+			fmt.Printf("Player #%s mmr: %0.2f(%+0.2f), rd: %0.2f, v: %0.2f, opponents: %d\n", ps.PlayerID,
+				ps.After.MMR, ps.Delta.MMR, ps.After.DR, ps.After.V, ps.Opponents)
+		}
+		fmt.Println("-----------------------------")
 		fmt.Println()
+
+		// 第一名阵营的第一名对 10 个其他阵营玩家和 4 个队友都是胜利
+		first, last := report.Players[0], report.Players[len(report.Players)-1]
+		if i == 0 && (math.Abs(first.After.MMR-1816.17) > 0.01 || first.Opponents != 14) {
+			t.Fatalf("unexpected settlement for %s: %+v", first.PlayerID, first)
+		}
+		if first.Delta.MMR <= 0 || last.Delta.MMR >= 0 {
+			t.Fatalf("expected the first player to gain and the last to lose, got %+v and %+v", first, last)
+		}
+	}
+}
+
+func Test_SettlerDraw(t *testing.T) {
+	settler := new(glicko2.Settler)
+	room, players := newSettleRoom([]int{1, 1}, []int{1, 1})
+
+	// 所有阵营和玩家排名都相同，整局为平局，评分不变，评分偏差降低
+	settler.UpdateMMR(room)
+	for _, teamPlayers := range players {
+		for _, p := range teamPlayers {
+			args := p.GetArgs()
+			if math.Abs(args.MMR-1500) > 1e-6 || args.DR >= 200 {
+				t.Fatalf("expected a full draw for %s, got %+v", p.ID(), args)
+			}
+		}
+	}
+}
+
+func Test_SettlerTeamComposite(t *testing.T) {
+	pairwise, _ := newSettleRoom([]int{1, 2, 3}, []int{1, 2, 3, 4, 5})
+	composite, _ := newSettleRoom([]int{1, 2, 3}, []int{1, 2, 3, 4, 5})
+	pr := new(glicko2.Settler).UpdateMMR(pairwise)
+	cr := glicko2.NewSettler(glicko2.SettlerArgs{Mode: glicko2.SettleModeTeamComposite}).UpdateMMR(composite)
+
+	// 合成模式下每个玩家只与 2 个合成对手对局，同阵营的玩家变化相同，且变化幅度比两两对局小
+	for i, ps := range cr.Players {
+		if ps.Opponents != 2 {
+			t.Fatalf("expected 2 composite opponents for %s, got %d", ps.PlayerID, ps.Opponents)
+		}
+		if math.Abs(ps.Delta.MMR-cr.Players[i/5*5].Delta.MMR) > 1e-9 {
+			t.Fatalf("expected teammates to move equally, got %+v", ps)
+		}
+	}
+	if first := cr.Players[0]; first.Delta.MMR <= 0 || first.Delta.MMR >= pr.Players[0].Delta.MMR {
+		t.Fatalf("expected a smaller gain than pairwise settlement, got %.2f and %.2f", first.Delta.MMR,
+			pr.Players[0].Delta.MMR)
+	}
+}
+
+func Test_SettlerPerformance(t *testing.T) {
+	setPerformance := func(players [][]glicko2.Player) {
+		for i, performance := range [][]float64{{30, 5}, {20, 20}} {
+			for j, v := range performance {
+				players[i][j].(*Player).SetPerformance(v)
+			}
+		}
+	}
+
+	// 只看阵营胜负时，阵营内按表现分占比计算，表现分相同的队友即使排名不同也是平局
+	room, players := newSettleRoom([]int{1, 2}, []int{1, 2})
+	setPerformance(players)
+	report := new(glicko2.Settler).UpdateMMR(room)
+	if math.Abs(report.Players[2].Delta.MMR-report.Players[3].Delta.MMR) > 1e-9 {
+		t.Fatalf("expected equal performers to move equally, got %+v and %+v", report.Players[2], report.Players[3])
+	}
+
+	// 加入个人表现的权重后，带飞的玩家比被带飞的玩家涨分多
+	room, players = newSettleRoom([]int{1, 2}, []int{1, 2})
+	setPerformance(players)
+	report = glicko2.NewSettler(glicko2.SettlerArgs{PerformanceWeight: 0.5}).UpdateMMR(room)
+	carry, carried := report.Players[0], report.Players[1]
+	if carry.Delta.MMR <= carried.Delta.MMR || carried.Delta.MMR >= 0 {
+		t.Fatalf("expected the carrying player to gain more than the carried one, got %+v and %+v", carry, carried)
+	}
+}
+
+func Test_SettlerRatedAi(t *testing.T) {
+	newAiRoom := func() (glicko2.Room, []glicko2.Player) {
+		room, players := newSettleRoom([]int{1}, []int{1, 1})
+		team := NewTeam()
+		team.SetRank(2)
+		group := NewGroup("ai-group", nil)
+		group.SetState(glicko2.GroupStateQueuing)
+		for i := 0; i < 2; i++ {
+			group.AddPlayers(NewPlayer(fmt.Sprintf("ai-player-%d", i+1), true, 1, glicko2.Args{}))
+		}
+		team.AddGroup(group)
+		room.AddTeam(team)
+		return room, append(players[0], group.Players()...)
+	}
+
+	// 没有配置 ai 评分时，击败 ai 不计入结算
+	room, _ := newAiRoom()
+	report := new(glicko2.Settler).UpdateMMR(room)
+	if report.Players[0].Delta.MMR != 0 || len(report.SkippedAi) != 2 {
+		t.Fatalf("expected unrated ai to be skipped, got %+v", report)
+	}
+
+	// 配置 ai 评分后，击败 ai 按其强度计入结算，2 个 ai 对手按上限 1 个的权重计入，ai 的参数不会更新
+	room, players := newAiRoom()
+	report = glicko2.NewSettler(glicko2.SettlerArgs{
+		AiRatings:      map[int64]glicko2.Args{1: {MMR: 1500, DR: 50, V: 0.06}},
+		MaxAiOpponents: 1,
+	}).UpdateMMR(room)
+	if len(report.Players) != 2 {
+		t.Fatalf("expected only humans to be settled, got %+v", report.Players)
+	}
+	for _, ps := range report.Players {
+		if ps.Delta.MMR <= 0 || ps.AiOpponents != 2 || ps.Opponents != 3 {
+			t.Fatalf("expected a capped win over the ai, got %+v", ps)
+		}
+	}
+	if args := players[2].GetArgs(); args.MMR != 0 {
+		t.Fatalf("expected ai args to stay untouched, got %+v", args)
+	}
+}
+
+func Test_SettlerAiCap(t *testing.T) {
+	// 真人阵营排在两个 5 人 ai 阵营之间，ai 与真人玩家强度相同
+	room, _ := newSettleRoom([]int{2}, []int{1})
+	for i, rank := range []int{1, 3} {
+		team := NewTeam()
+		team.SetRank(rank)
+		group := NewGroup(fmt.Sprintf("ai-group-%d", i+1), nil)
+		group.SetState(glicko2.GroupStateQueuing)
+		for j := 0; j < 5; j++ {
+			group.AddPlayers(NewPlayer(fmt.Sprintf("ai-player-%d-%d", i+1, j+1), true, 1, glicko2.Args{}))
+		}
+		team.AddGroup(group)
+		room.AddTeam(team)
+	}
+
+	// 上限为 5 时 5 负 5 胜各按一半的权重计入，不会只计入排在前面的 5 个 ai
+	report := glicko2.NewSettler(glicko2.SettlerArgs{
+		AiRatings:      map[int64]glicko2.Args{1: {MMR: 1500, DR: 200, V: 0.06}},
+		MaxAiOpponents: 5,
+	}).UpdateMMR(room)
+	if ps := report.Players[0]; ps.AiOpponents != 10 || math.Abs(ps.Delta.MMR) > 1e-6 {
+		t.Fatalf("expected balanced results against the ai above and below, got %+v", ps)
+	}
+}
+
+func Test_SettlerInactivity(t *testing.T) {
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{
+		InactivityPeriod: 24 * time.Hour,
+		MaxInactivityDR:  300,
+	})
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	active, inactive := players[0][0], players[1][0]
+
+	// 结算后记录参数更新到的时间
+	settler.UpdateMMR(room)
+	now := time.Now()
+	if rated := inactive.(glicko2.ActivityPlayer).GetRatedTimeSec(); now.Unix()-rated > 1 {
+		t.Fatalf("expected rated time to be set on settlement, got %d", rated)
+	}
+
+	// 三个周期不活跃，RD² 增加 3·(σ·173.7178)²
+	before := *inactive.GetArgs()
+	inactive.(glicko2.ActivityPlayer).SetRatedTimeSec(now.Add(-3*24*time.Hour - time.Hour).Unix())
+	report := settler.ApplyInactivity([]glicko2.Player{active, inactive}, now)
+	if len(report.Players) != 1 || report.Players[0].PlayerID != inactive.ID() {
+		t.Fatalf("expected only the inactive player to change, got %+v", report.Players)
+	}
+	sigma := before.V * 173.7178
+	if dr := math.Sqrt(before.DR*before.DR + 3*sigma*sigma); math.Abs(inactive.GetArgs().DR-dr) > 1e-9 {
+		t.Fatalf("expected rd %0.4f, got %0.4f", dr, inactive.GetArgs().DR)
+	}
+
+	// 已经计算过的周期不会重复计算
+	if report = settler.ApplyInactivity([]glicko2.Player{inactive}, now); len(report.Players) != 0 {
+		t.Fatalf("expected no change when applied again, got %+v", report.Players)
+	}
+
+	// 最多增长到 MaxInactivityDR
+	settler.ApplyInactivity([]glicko2.Player{inactive}, now.Add(10000*24*time.Hour))
+	if inactive.GetArgs().DR != 300 {
+		t.Fatalf("expected rd to be capped at 300, got %0.4f", inactive.GetArgs().DR)
+	}
+}
+
+func Test_SettlerRatingSystem(t *testing.T) {
+	room, _ := newSettleRoom([]int{1, 2}, []int{1, 2})
+	base := new(glicko2.Settler).UpdateMMR(room)
+
+	// 评分尺度放大一倍、中心移到 4000 后，同样的对局得到的变化也放大一倍
+	system := glicko2.RatingSystem{DefaultMMR: 4000, Scale: 2 * 173.7178, MinDR: 390}
+	scaled, players := newSettleRoom([]int{1, 2}, []int{1, 2})
+	for _, team := range players {
+		for _, p := range team {
+			if err := p.SetArgs(&glicko2.Args{MMR: 4000, DR: 400, V: 0.06}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	report := glicko2.NewSettler(glicko2.SettlerArgs{System: system}).UpdateMMR(scaled)
+	for i, ps := range report.Players {
+		if math.Abs(ps.Delta.MMR-2*base.Players[i].Delta.MMR) > 1e-6 {
+			t.Fatalf("expected mmr delta %0.4f, got %0.4f", 2*base.Players[i].Delta.MMR, ps.Delta.MMR)
+		}
+		// 评分偏差不低于 MinDR
+		if ps.After.DR != 390 {
+			t.Fatalf("expected rd to be clamped to 390, got %0.4f", ps.After.DR)
+		}
+	}
+}
+
+func Test_SettlerHighDR(t *testing.T) {
+	// 赛季重置后评分偏差为 700 的玩家结算一局后，评分偏差不会被压到新玩家的 350
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	if err := players[0][0].SetArgs(&glicko2.Args{MMR: 1500, DR: 700, V: 0.06}); err != nil {
+		t.Fatal(err)
+	}
+	if err := players[1][0].SetArgs(&glicko2.Args{MMR: 1500, DR: 350, V: 0.06}); err != nil {
+		t.Fatal(err)
+	}
+	report := new(glicko2.Settler).UpdateMMR(room)
+	if dr := report.Players[0].After.DR; dr <= 350 || dr >= 700 {
+		t.Fatalf("expected rd between 350 and 700 after one game, got %0.4f", dr)
+	}
+
+	// 配置了 MaxDR 时才有上限
+	room, players = newSettleRoom([]int{1, 2}, []int{1})
+	if err := players[0][0].SetArgs(&glicko2.Args{MMR: 1500, DR: 700, V: 0.06}); err != nil {
+		t.Fatal(err)
+	}
+	report = glicko2.NewSettler(glicko2.SettlerArgs{System: glicko2.RatingSystem{MaxDR: 350}}).UpdateMMR(room)
+	if dr := report.Players[0].After.DR; dr != 350 {
+		t.Fatalf("expected rd to be capped at 350, got %0.4f", dr)
+	}
+}
+
+func Test_SettlerParticipation(t *testing.T) {
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{LeaverTeammateLossReduction: 0.5})
+	baseRoom, _ := newSettleRoom([]int{1, 2}, []int{1, 2, 3})
+	base := settler.UpdateMMR(baseRoom)
+
+	room, players := newSettleRoom([]int{1, 2}, []int{1, 2, 3})
+	players[0][1].(*Player).SetParticipation(glicko2.ParticipationLate, 0.5)
+	players[0][2].(*Player).SetParticipation(glicko2.ParticipationLeft, 0)
+	players[1][1].(*Player).SetParticipation(glicko2.ParticipationAfk, 0)
+	report := settler.UpdateMMR(room)
+	if len(report.Errors) != 0 {
+		t.Fatal(report.Errors)
+	}
+
+	// 中途加入的玩家按参与比例降低了变化幅度
+	if late := report.Players[1]; late.Delta.MMR <= 0 || late.Delta.MMR >= base.Players[1].Delta.MMR {
+		t.Fatalf("expected a smaller gain for the late player, got %+v", late)
+	}
+	// 中途退出和挂机的玩家即使阵营获胜也对所有对手记为失败，与最后一名掉分相同
+	for _, i := range []int{2, 4} {
+		if leaver := report.Players[i]; math.Abs(leaver.Delta.MMR-base.Players[5].Delta.MMR) > 1e-9 {
+			t.Fatalf("expected the leaver to lose against everyone, got %+v", leaver)
+		}
+	}
+	// 挂机玩家的队友输掉的对局权重降低，掉分更少
+	for _, i := range []int{3, 5} {
+		if mate := report.Players[i]; mate.Delta.MMR <= base.Players[i].Delta.MMR {
+			t.Fatalf("expected the leaver's teammate to lose less, got %+v and %+v", mate, base.Players[i])
+		}
+	}
+}
+
+func Test_SettlerLeaverRankedFirst(t *testing.T) {
+	settler := new(glicko2.Settler)
+	baseRoom, _ := newSettleRoom([]int{1, 2}, []int{1, 2, 3})
+	base := settler.UpdateMMR(baseRoom)
+
+	// 退出的玩家被服务器排在阵营第一，队友和对手仍然对其记为获胜
+	room, players := newSettleRoom([]int{1, 2}, []int{1, 2, 3})
+	players[1][0].(*Player).SetParticipation(glicko2.ParticipationLeft, 0)
+	report := settler.UpdateMMR(room)
+	if leaver := report.Players[3]; math.Abs(leaver.Delta.MMR-base.Players[5].Delta.MMR) > 1e-9 {
+		t.Fatalf("expected the leaver to lose against everyone, got %+v", leaver)
+	}
+	// 排在退出者后面的队友不会输给退出者
+	for _, i := range []int{4, 5} {
+		if mate := report.Players[i]; mate.Delta.MMR <= base.Players[i].Delta.MMR {
+			t.Fatalf("expected the leaver's teammate to beat the leaver, got %+v and %+v", mate, base.Players[i])
+		}
+	}
+}
+
+func Test_SettlerCompositeLeaver(t *testing.T) {
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{Mode: glicko2.SettleModeTeamComposite})
+
+	// 排在第一的玩家中途退出，对手记为获胜
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	players[0][0].(*Player).SetParticipation(glicko2.ParticipationLeft, 0)
+	report := settler.UpdateMMR(room)
+	leaver, opponent := report.Players[0], report.Players[1]
+	if leaver.Delta.MMR >= 0 || opponent.Delta.MMR <= 0 || math.Abs(leaver.Delta.MMR+opponent.Delta.MMR) > 1e-9 {
+		t.Fatalf("expected the opponent to beat the leaver, got %+v and %+v", leaver, opponent)
+	}
+
+	// 退出的玩家不计入合成对手，对手获胜的部分按退出玩家的比例计算
+	baseRoom, _ := newSettleRoom([]int{1, 2}, []int{1, 2})
+	base := settler.UpdateMMR(baseRoom)
+	room, players = newSettleRoom([]int{1, 2}, []int{1, 2})
+	players[0][0].(*Player).SetParticipation(glicko2.ParticipationLeft, 0)
+	report = settler.UpdateMMR(room)
+	for _, i := range []int{2, 3} {
+		if ps := report.Players[i]; ps.Delta.MMR <= base.Players[i].Delta.MMR {
+			t.Fatalf("expected the leaver's opponents to lose less, got %+v and %+v", ps, base.Players[i])
+		}
+	}
+}
+
+func Test_SettlerPlacement(t *testing.T) {
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{PlacementStepScale: 2})
+	baseRoom, _ := newSettleRoom([]int{1, 2}, []int{1})
+	base := settler.UpdateMMR(baseRoom)
+
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	player := players[0][0]
+	player.(*Player).StartPlacement(2, 1000)
+
+	// 定级期间按 PlacementMMR 匹配
+	group := room.Teams()[0].Groups()[0]
+	if !glicko2.InPlacement(player) || group.MMR() != 1000 {
+		t.Fatalf("expected the group to be matched at 1000 during placement, got %0.2f", group.MMR())
+	}
+
+	// 定级期间 mmr 变化放大
+	report := settler.UpdateMMR(room)
+	if ps := report.Players[0]; !ps.Placement || math.Abs(ps.Delta.MMR-2*base.Players[0].Delta.MMR) > 1e-9 {
+		t.Fatalf("expected a doubled mmr delta during placement, got %+v", ps)
+	}
+	if report.Players[1].Placement || report.Players[1].Delta.MMR != base.Players[1].Delta.MMR {
+		t.Fatalf("expected the other player to settle normally, got %+v", report.Players[1])
+	}
+
+	// 完成定级后按真实 mmr 匹配
+	settler.UpdateMMR(room)
+	if glicko2.InPlacement(player) || group.MMR() != player.GetArgs().MMR {
+		t.Fatalf("expected the group to be matched at the real mmr after placement, got %0.2f", group.MMR())
+	}
+}
+
+func Test_SettlerIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settlements.jsonl")
+	store, err := glicko2.NewFileSettlementStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	room.(*Room).SetID(42)
+	winner := players[0][0]
+
+	first := glicko2.NewSettler(glicko2.SettlerArgs{Store: store}).UpdateMMR(room)
+	if first.Duplicate || len(first.Errors) != 0 || winner.GetArgs().MMR != first.Players[0].After.MMR {
+		t.Fatalf("unexpected first settlement: %+v", first)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开文件后，同一个房间不会再次结算
+	store, err = glicko2.NewFileSettlementStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{Store: store})
+	again := settler.UpdateMMR(room)
+	if !again.Duplicate || again.Players[0] != first.Players[0] || winner.GetArgs().MMR != first.Players[0].After.MMR {
+		t.Fatalf("expected the earlier report without settling again, got %+v", again)
+	}
+
+	// 强制重新结算：先撤销第一次结算，排名不变时结果也不变
+	forced := settler.ForceUpdateMMR(room)
+	if forced.Duplicate || math.Abs(forced.Players[0].Before.MMR-first.Players[0].Before.MMR) > 1e-9 ||
+		math.Abs(winner.GetArgs().MMR-first.Players[0].After.MMR) > 1e-9 {
+		t.Fatalf("expected the forced settlement to replace the first one, got %+v", forced)
+	}
+	if latest, _ := store.Load(42); latest.Players[0] != forced.Players[0] {
+		t.Fatalf("expected the forced report to replace the earlier one, got %+v", latest)
+	}
+}
+
+func Test_SettlerForceUpdate(t *testing.T) {
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{
+		Store:   glicko2.NewMemorySettlementStore(),
+		Journal: glicko2.NewMemoryJournal(),
+	})
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	teams := append([]glicko2.Team(nil), room.Teams()...)
+	room.(*Room).SetID(1)
+	all := []glicko2.Player{players[0][0], players[1][0]}
+	initial := *all[0].GetArgs()
+	settler.UpdateMMR(room)
+
+	// 修正排名后强制重新结算两次，结果与只按修正后的排名结算一次相同
+	teams[0].SetRank(2)
+	teams[1].SetRank(1)
+	for i := 0; i < 2; i++ {
+		if report := settler.ForceUpdateMMR(room); report.Duplicate || len(report.Errors) != 0 {
+			t.Fatalf("unexpected forced settlement: %+v", report)
+		}
+	}
+	corrected, expected := newSettleRoom([]int{2, 1}, []int{1})
+	new(glicko2.Settler).UpdateMMR(corrected)
+	for i, p := range all {
+		got, want := *p.GetArgs(), *expected[i][0].GetArgs()
+		if math.Abs(got.MMR-want.MMR) > 1e-9 || math.Abs(got.DR-want.DR) > 1e-9 || math.Abs(got.V-want.V) > 1e-9 {
+			t.Fatalf("expected %+v after forced settlements, got %+v", want, got)
+		}
+	}
+
+	// 反向变化只撤销最后一次结算
+	if _, err := settler.Rollback(1, all, glicko2.RollbackPolicyInverseDelta); err != nil {
+		t.Fatal(err)
+	}
+	if got := *all[0].GetArgs(); math.Abs(got.MMR-initial.MMR) > 1e-9 || math.Abs(got.DR-initial.DR) > 1e-9 {
+		t.Fatalf("expected %+v after rollback, got %+v", initial, got)
+	}
+}
+
+func Test_SettlerRollbackForceUpdate(t *testing.T) {
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{
+		Store:   glicko2.NewMemorySettlementStore(),
+		Journal: glicko2.NewMemoryJournal(),
+	})
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	room.(*Room).SetID(7)
+	all := []glicko2.Player{players[0][0], players[1][0]}
+	winner := all[0]
+	first := settler.UpdateMMR(room)
+
+	if _, err := settler.Rollback(7, all, glicko2.RollbackPolicyInverseDelta); err != nil {
+		t.Fatal(err)
+	}
+	if report := settler.UpdateMMR(room); !report.Duplicate || !report.RolledBack {
+		t.Fatalf("expected the stored report to be marked as rolled back, got %+v", report)
+	}
+
+	// 撤销后强制重新结算不会再撤销一次第一次结算
+	forced := settler.ForceUpdateMMR(room)
+	if forced.Players[0].Before.MMR != 1500 || math.Abs(winner.GetArgs().MMR-first.Players[0].After.MMR) > 1e-9 {
+		t.Fatalf("expected the forced settlement to start from 1500, got %+v", forced.Players[0])
+	}
+
+	// 重新结算的结果可以再次撤销
+	if _, err := settler.Rollback(7, all, glicko2.RollbackPolicyRecompute); err != nil {
+		t.Fatal(err)
+	}
+	if got := winner.GetArgs().MMR; math.Abs(got-1500) > 1e-9 {
+		t.Fatalf("expected mmr 1500 after the second rollback, got %0.4f", got)
+	}
+}
+
+func Test_SettlerRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := glicko2.NewFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{Journal: journal})
+
+	// 同样的两个玩家先后进行两局，第一局 player 获胜，第二局 player 失败
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	teams := append([]glicko2.Team(nil), room.Teams()...)
+	all := []glicko2.Player{players[0][0], players[1][0]}
+	player := players[0][0]
+	room.(*Room).SetID(1)
+	settler.UpdateMMR(room)
+	room.(*Room).SetID(2)
+	teams[0].SetRank(2)
+	teams[1].SetRank(1)
+	second := settler.UpdateMMR(room)
+
+	// 重新计算：撤销第一局后，与只进行了第二局的结果相同，对手仍使用第二局时的参数
+	onlySecond, expected := newSettleRoom([]int{2, 1}, []int{1})
+	for _, ps := range second.Players {
+		if ps.PlayerID != player.ID() {
+			opponent := ps.Before
+			if err := expected[1][0].SetArgs(&opponent); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	new(glicko2.Settler).UpdateMMR(onlySecond)
+	if _, err := settler.Rollback(1, all, glicko2.RollbackPolicyRecompute); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := *player.GetArgs(), *expected[0][0].GetArgs(); math.Abs(got.MMR-want.MMR) > 1e-9 || math.Abs(got.DR-want.DR) > 1e-9 {
+		t.Fatalf("expected %+v after recompute, got %+v", want, got)
+	}
+	if _, err := settler.Rollback(1, all, glicko2.RollbackPolicyRecompute); !errors.Is(err, glicko2.ErrRoomRolledBack) {
+		t.Fatalf("expected ErrRoomRolledBack, got %v", err)
+	}
+
+	// 反向变化：在当前参数上减去第二局带来的变化
+	before := *player.GetArgs()
+	report, err := settler.Rollback(2, all, glicko2.RollbackPolicyInverseDelta)
+	if err != nil || len(report.Errors) != 0 {
+		t.Fatal(err, report.Errors)
+	}
+	var delta glicko2.Args
+	for _, ps := range second.Players {
+		if ps.PlayerID == player.ID() {
+			delta = ps.Delta
+		}
+	}
+	if got := player.GetArgs().MMR; math.Abs(got-(before.MMR-delta.MMR)) > 1e-9 {
+		t.Fatalf("expected mmr %0.4f after inverse delta, got %0.4f", before.MMR-delta.MMR, got)
+	}
+
+	// 重新打开日志后记录还在
+	reopened, err := glicko2.NewFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if entries, _ := reopened.PlayerEntries(player.ID()); len(entries) != 4 {
+		t.Fatalf("expected 2 settlements and 2 rollbacks in the journal, got %d", len(entries))
+	}
+}
+
+func Test_SettlerStreak(t *testing.T) {
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{
+		Streak: glicko2.StreakArgs{
+			MinStreak:       3,
+			OnlyLosing:      true,
+			VolatilityScale: 1.5,
+			DRIncrease:      30,
+		},
+	})
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	winner, loser := players[0][0], players[1][0]
+
+	for i := 1; i <= 3; i++ {
+		report := settler.UpdateMMR(room)
+		w, l := report.Players[0], report.Players[1]
+		if w.Streak != i || l.Streak != -i || winner.(*Player).GetStreak() != i || loser.(*Player).GetStreak() != -i {
+			t.Fatalf("unexpected streaks after game %d: %d and %d", i, w.Streak, l.Streak)
+		}
+		if w.Adjustment != (glicko2.Args{}) {
+			t.Fatalf("expected no adjustment for a winning streak, got %+v", w.Adjustment)
+		}
+		if i < 3 && l.Adjustment != (glicko2.Args{}) {
+			t.Fatalf("expected no adjustment before the streak reaches 3, got %+v", l.Adjustment)
+		}
+		if i == 3 {
+			// 调整前的波动率为 After.V - Adjustment.V
+			if math.Abs(l.Adjustment.V-(l.After.V-l.Adjustment.V)*0.5) > 1e-9 || l.Adjustment.DR != 30 {
+				t.Fatalf("unexpected adjustment for a losing streak: %+v", l)
+			}
+		}
+	}
+
+	// 平局清零
+	room.Teams()[1].SetRank(1)
+	report := settler.UpdateMMR(room)
+	if report.Players[0].Streak != 0 || loser.(*Player).GetStreak() != 0 || report.Players[1].Adjustment != (glicko2.Args{}) {
+		t.Fatalf("expected a draw to reset the streak, got %+v", report.Players)
+	}
+}
+
+func Test_SettlerStreakTeams(t *testing.T) {
+	settler := glicko2.NewSettler(glicko2.SettlerArgs{Streak: glicko2.StreakArgs{MinStreak: 3}})
+	room, players := newSettleRoom([]int{1, 2, 3}, []int{1, 2, 3, 4, 5})
+	players[0][4].(*Player).SetParticipation(glicko2.ParticipationLeft, 0)
+	settler.UpdateMMR(room)
+
+	// 连胜连败只看阵营的排名：第一名的阵营都记为胜，中间的阵营记为平，最后一名的阵营都记为负，退出的玩家记为负
+	for i, want := range []int{1, 0, -1} {
+		for j, p := range players[i] {
+			if i == 0 && j == 4 {
+				want = -1
+			}
+			if got := p.(*Player).GetStreak(); got != want {
+				t.Fatalf("expected streak %d for %s, got %d", want, p.ID(), got)
+			}
+		}
 	}
 }
@@ -0,0 +1,78 @@
+package example
+
+import (
+	"testing"
+
+	"github.com/hedon954/glicko2-matcher"
+)
+
+func Test_StarLadder(t *testing.T) {
+	ladder := glicko2.NewStarLadder(glicko2.StarLadderArgs{
+		RankStars: []int{2, -1},
+		Tiers: []glicko2.Tier{
+			{Name: "bronze", MinStar: 0},
+			{
+				Name:           "silver",
+				MinStar:        10,
+				ProtectedGames: 2,
+				Promotion:      glicko2.Series{Games: 3, Wins: 2},
+				Demotion:       glicko2.Series{Games: 3, Wins: 2},
+			},
+		},
+	})
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+	teams := append([]glicko2.Team(nil), room.Teams()...)
+	player := players[0][0]
+	player.SetStar(8)
+
+	// 依次为 player 的胜负，以及每局之后的星数和是否在晋级赛或保级赛中
+	steps := []struct {
+		win      bool
+		star     int
+		inSeries bool
+	}{
+		{true, 9, true},    // 跨过白银，停在前一星开始晋级赛
+		{true, 9, true},    // 晋级赛 1 胜
+		{false, 9, true},   // 晋级赛 1 胜 1 负
+		{true, 10, false},  // 晋级赛 2 胜，晋升白银，进入 2 局保护期
+		{false, 10, false}, // 保护期内不降级
+		{false, 10, false}, // 保护期内不降级
+		{false, 10, true},  // 保护期结束，开始保级赛
+		{false, 10, true},  // 保级赛 1 负
+		{false, 9, false},  // 保级赛 2 负，降级
+	}
+	for i, step := range steps {
+		if step.win {
+			teams[0].SetRank(1)
+			teams[1].SetRank(2)
+		} else {
+			teams[0].SetRank(2)
+			teams[1].SetRank(1)
+		}
+		ladder.Update(room)
+		state := player.(glicko2.LadderPlayer).GetLadderState()
+		if player.Star() != step.star || state.InSeries != step.inSeries {
+			t.Fatalf("step %d: expected star %d and in series %v, got %d and %+v", i, step.star, step.inSeries, player.Star(), state)
+		}
+	}
+}
+
+func Test_StarLadderBonus(t *testing.T) {
+	ladder := glicko2.NewStarLadder(glicko2.StarLadderArgs{
+		RankStars:     []int{1, -1},
+		BaseMMR:       1000,
+		MMRPerStar:    10,
+		BonusMMRGap:   100,
+		MaxBonusStars: 2,
+	})
+	room, players := newSettleRoom([]int{1, 2}, []int{1})
+
+	// mmr 1500 远高于 0 星对应的 1000，获胜时额外加 2 颗星，失败时不受影响
+	report := ladder.Update(room)
+	if winner := report.Players[0]; winner.AfterStar != 3 || winner.BonusStars != 2 {
+		t.Fatalf("expected the winner to get 2 bonus stars, got %+v", winner)
+	}
+	if loser := report.Players[1]; loser.AfterStar != 0 || players[1][0].Star() != 0 {
+		t.Fatalf("expected the loser to stay at 0 stars, got %+v", loser)
+	}
+}
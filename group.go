@@ -37,7 +37,7 @@ type Group interface {
 	// 从队伍中移除玩家
 	RemovePlayer(player Player)
 
-	// 获取队伍 mmr 值
+	// 获取队伍 mmr 值，玩家的 mmr 应使用 MatchingMMR 获取，以便定级期间按 PlacementMMR 匹配
 	MMR() float64
 
 	// 获取队伍段位值
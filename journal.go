@@ -0,0 +1,253 @@
+package glicko2
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	glicko "github.com/zelenin/go-glicko2"
+)
+
+// JournalKind 结算日志的类型
+type JournalKind uint8
+
+const (
+	JournalKindSettle     JournalKind = iota // 一局游戏或一个计算周期的结算
+	JournalKindInactivity                    // 不活跃玩家的评分偏差增长
+	JournalKindRollback                      // 撤销一局游戏的结算
+)
+
+// JournalEntry 是一个玩家的一次参数变化
+type JournalEntry struct {
+	Seq        int64 // 写入日志的序号，由 SettlementJournal 分配，从 1 开始递增
+	TimeSec    int64
+	Kind       JournalKind
+	RoomID     int64   // 计算周期的结算和不活跃增长为 0
+	Rooms      []int64 // 计算周期的结算中玩家参与的房间，用于撤销其中一局游戏
+	PlayerID   string
+	Before     Args
+	After      Args
+	Placement  bool             // 结算时是否在定级期间
+	Outcomes   []JournalOutcome // 结算时计入的对局，用于重新计算
+	Adjustment Args             // 结算后额外的调整（如连胜连败），重新计算时原样加上
+}
+
+// JournalOutcome 是结算时计入的一个对局
+type JournalOutcome struct {
+	RoomID   int64 // 对局所在的房间
+	Opponent Args
+	Score    float64
+	Weight   float64
+}
+
+// SettlementJournal 是只追加的结算日志，Settler 会为每个参数有变化的玩家写入一条记录
+type SettlementJournal interface {
+
+	// Append 追加记录，并为每条记录分配序号
+	Append(entries ...JournalEntry) error
+
+	// RoomEntries 按写入顺序获取房间的所有记录，包括 Rooms 中有这个房间的计算周期的结算
+	RoomEntries(roomID int64) ([]JournalEntry, error)
+
+	// PlayerEntries 按写入顺序获取玩家的所有记录
+	PlayerEntries(playerID string) ([]JournalEntry, error)
+}
+
+// MemoryJournal 是内存中的 SettlementJournal，进程重启后会丢失
+type MemoryJournal struct {
+	sync.RWMutex
+	entries []JournalEntry
+	rooms   map[int64][]int  // 房间 ID 到记录下标
+	players map[string][]int // 玩家 ID 到记录下标
+}
+
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{
+		rooms:   make(map[int64][]int),
+		players: make(map[string][]int),
+	}
+}
+
+func (j *MemoryJournal) Append(entries ...JournalEntry) error {
+	j.Lock()
+	defer j.Unlock()
+
+	j.append(entries)
+	return nil
+}
+
+// append 追加记录并分配序号，需要持有锁
+func (j *MemoryJournal) append(entries []JournalEntry) {
+	for i := range entries {
+		idx := len(j.entries)
+		entries[i].Seq = int64(idx) + 1
+		j.rooms[entries[i].RoomID] = append(j.rooms[entries[i].RoomID], idx)
+		for _, roomID := range entries[i].Rooms {
+			j.rooms[roomID] = append(j.rooms[roomID], idx)
+		}
+		j.players[entries[i].PlayerID] = append(j.players[entries[i].PlayerID], idx)
+		j.entries = append(j.entries, entries[i])
+	}
+}
+
+func (j *MemoryJournal) RoomEntries(roomID int64) ([]JournalEntry, error) {
+	j.RLock()
+	defer j.RUnlock()
+
+	return j.collect(j.rooms[roomID]), nil
+}
+
+func (j *MemoryJournal) PlayerEntries(playerID string) ([]JournalEntry, error) {
+	j.RLock()
+	defer j.RUnlock()
+
+	return j.collect(j.players[playerID]), nil
+}
+
+func (j *MemoryJournal) collect(indexes []int) []JournalEntry {
+	res := make([]JournalEntry, len(indexes))
+	for i, idx := range indexes {
+		res[i] = j.entries[idx]
+	}
+	return res
+}
+
+// FileJournal 是以文件保存的 SettlementJournal，每条记录以一行 JSON 追加写入文件，打开时加载文件中所有的记录
+type FileJournal struct {
+	file   *os.File
+	memory *MemoryJournal
+}
+
+// NewFileJournal 打开或创建 path 对应的文件，并加载其中的记录
+func NewFileJournal(path string) (*FileJournal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open settlement journal: %w", err)
+	}
+	j := &FileJournal{
+		file:   file,
+		memory: NewMemoryJournal(),
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("decode settlement journal line %d: %w", line, err)
+		}
+		j.memory.append([]JournalEntry{entry})
+	}
+	if err := scanner.Err(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("read settlement journal: %w", err)
+	}
+	return j, nil
+}
+
+// Append 先写入文件，写入成功后才对查询可见
+func (j *FileJournal) Append(entries ...JournalEntry) error {
+	j.memory.Lock()
+	defer j.memory.Unlock()
+
+	var data []byte
+	for i := range entries {
+		entries[i].Seq = int64(len(j.memory.entries)+i) + 1
+		line, err := json.Marshal(entries[i])
+		if err != nil {
+			return fmt.Errorf("encode journal entry for player %s: %w", entries[i].PlayerID, err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if _, err := j.file.Write(data); err != nil {
+		return fmt.Errorf("write settlement journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("sync settlement journal: %w", err)
+	}
+	j.memory.append(entries)
+	return nil
+}
+
+func (j *FileJournal) RoomEntries(roomID int64) ([]JournalEntry, error) {
+	return j.memory.RoomEntries(roomID)
+}
+
+func (j *FileJournal) PlayerEntries(playerID string) ([]JournalEntry, error) {
+	return j.memory.PlayerEntries(playerID)
+}
+
+// Close 关闭文件
+func (j *FileJournal) Close() error {
+	j.memory.Lock()
+	defer j.memory.Unlock()
+
+	return j.file.Close()
+}
+
+// newJournalEntry 根据玩家的结算结果构建日志记录
+func newJournalEntry(kind JournalKind, roomID int64, ps PlayerSettlement, outcomes []outcome) JournalEntry {
+	entry := JournalEntry{
+		TimeSec:    time.Now().Unix(),
+		Kind:       kind,
+		RoomID:     roomID,
+		PlayerID:   ps.PlayerID,
+		Before:     ps.Before,
+		After:      ps.After,
+		Placement:  ps.Placement,
+		Adjustment: ps.Adjustment,
+	}
+	for _, o := range outcomes {
+		entry.Outcomes = append(entry.Outcomes, JournalOutcome{
+			RoomID:   o.room,
+			Opponent: o.opponent,
+			Score:    float64(o.score),
+			Weight:   o.weight,
+		})
+	}
+	return entry
+}
+
+// outcomes 将日志记录中的对局还原为结算时的对局
+func (e JournalEntry) outcomes() []outcome {
+	res := make([]outcome, len(e.Outcomes))
+	for i, o := range e.Outcomes {
+		res[i] = outcome{
+			room:     o.RoomID,
+			opponent: o.Opponent,
+			score:    glicko.MatchResult(o.Score),
+			weight:   o.Weight,
+		}
+	}
+	return res
+}
+
+// settles 记录是否是 roomID 的结算，计算周期的结算包含周期内所有的房间
+func (e JournalEntry) settles(roomID int64) bool {
+	if e.Kind != JournalKindSettle {
+		return false
+	}
+	if e.RoomID == roomID {
+		return true
+	}
+	for _, id := range e.Rooms {
+		if id == roomID {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJournal 写入结算日志，失败时记录到报告中
+func (s *Settler) writeJournal(report *SettlementReport, entries []JournalEntry) {
+	if s.Journal == nil || len(entries) == 0 {
+		return
+	}
+	if err := s.Journal.Append(entries...); err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("append settlement journal: %w", err))
+	}
+}
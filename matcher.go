@@ -1,6 +1,8 @@
 package glicko2
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -9,109 +11,360 @@ import (
 const (
 	TeamQueue   = "TeamQueue"
 	NormalQueue = "NormalQueue"
+
+	defaultTickInterval = time.Second
+)
+
+// MatcherState 匹配器状态
+type MatcherState uint8
+
+const (
+	MatcherStateIdle     MatcherState = iota // 未启动
+	MatcherStateRunning                      // 匹配中
+	MatcherStateDraining                     // 排空中，不再接收新的队伍，但会继续匹配已在队列中的队伍
+	MatcherStateStopped                      // 已停止
 )
 
+var (
+	ErrMatcherStarted      = errors.New("matcher has already been started")
+	ErrMatcherStopped      = errors.New("matcher has been stopped")
+	ErrMatcherNotRunning   = errors.New("matcher is not running")
+	ErrMatcherNotAccepting = errors.New("matcher is not accepting new groups")
+	ErrQueueNotFound       = errors.New("queue not found")
+)
+
+// MatcherArgs 匹配器参数
+type MatcherArgs struct {
+	TickInterval     time.Duration // 定时匹配的间隔，为 0 时默认 1s
+	MinRoundInterval time.Duration // 两轮匹配之间的最小间隔，用于限制提前触发匹配的频率，0 表示不限制
+
+	QueueArgs QueueArgs     // 默认队列参数
+	Queues    []QueueConfig // 自定义队列，为空时使用 NormalQueue 和 TeamQueue 两个默认队列，都使用 QueueArgs
+	Router    Router        // 队伍的路由策略，为空时使用 NewDefaultRouting(QueueArgs)
+
+	ResultChan chan MatchResult  // 匹配成功的房间会同时投递带有匹配质量信息的 MatchResult，为空时不投递
+	Observers  []MatcherObserver // 匹配事件的观察者
+}
+
+// QueueConfig 队列配置
+type QueueConfig struct {
+	Name string
+	Args QueueArgs
+}
+
 type Matcher struct {
-	quitChan chan struct{}
+	sync.Mutex
+	state       MatcherState
+	started     bool          // 是否启动过匹配循环
+	quitChan    chan struct{} // 关闭后匹配循环退出
+	doneChan    chan struct{} // 匹配循环退出后关闭
+	triggerChan chan struct{} // 队列人数达到阈值时提前触发一轮匹配
+	stopOnce    sync.Once
+	roundMutex  sync.Mutex // 一轮匹配过程中持有，保证取消匹配时队伍不会处于正在匹配的中间状态
+	lastRound   time.Time  // 上一轮匹配的开始时间，只在匹配循环中访问
+
+	queues   []*Queue          // 所有的匹配队列，按配置顺序排列
+	queueMap map[string]*Queue // 队列名称到队列的映射
 
-	NormalQueue *Queue // 普通车队
-	TeamQueue   *Queue // 车队专属队列
+	MatcherArgs
 }
 
-// NewMatcher 是一个匹配器，包含了 TeamQueue 和 NormalQueue 两个匹配队列
+// NewMatcher 是一个匹配器，默认包含了 TeamQueue 和 NormalQueue 两个匹配队列，
+// 也可以通过 MatcherArgs.Queues 和 MatcherArgs.Router 自定义队列和路由策略
 func NewMatcher(
 	roomChan chan Room,
-	queueArgs QueueArgs,
+	args MatcherArgs,
 	newTeamFunc func() Team,
 	newRoomFunc func() Room,
 	newRoomWithAiFunc func(team Team) Room,
 ) *Matcher {
-	return &Matcher{
+	if args.TickInterval <= 0 {
+		args.TickInterval = defaultTickInterval
+	}
+	if len(args.Queues) == 0 {
+		args.Queues = []QueueConfig{
+			{Name: NormalQueue, Args: args.QueueArgs},
+			{Name: TeamQueue, Args: args.QueueArgs},
+		}
+	}
+	if args.Router == nil {
+		args.Router = NewDefaultRouting(args.QueueArgs)
+	}
+
+	qm := &Matcher{
+		state:       MatcherStateIdle,
 		quitChan:    make(chan struct{}),
-		NormalQueue: NewQueue(NormalQueue, roomChan, queueArgs, newTeamFunc, newRoomFunc, newRoomWithAiFunc),
-		TeamQueue:   NewQueue(TeamQueue, roomChan, queueArgs, newTeamFunc, newRoomFunc, newRoomWithAiFunc),
+		doneChan:    make(chan struct{}),
+		triggerChan: make(chan struct{}, 1),
+		queues:      make([]*Queue, 0, len(args.Queues)),
+		queueMap:    make(map[string]*Queue, len(args.Queues)),
+		MatcherArgs: args,
+	}
+	for _, qc := range args.Queues {
+		q := NewQueue(qc.Name, roomChan, qc.Args, newTeamFunc, newRoomFunc, newRoomWithAiFunc)
+		q.resultChan = args.ResultChan
+		q.observer = observers(args.Observers)
+		qm.queues = append(qm.queues, q)
+		qm.queueMap[qc.Name] = q
 	}
+	return qm
+}
+
+// Queue 通过名称获取队列，不存在时返回 nil
+func (qm *Matcher) Queue(name string) *Queue {
+	return qm.queueMap[name]
 }
 
-// AddGroups 添加队伍
-func (qm *Matcher) AddGroups(gs ...Group) {
-	for _, g := range gs {
-		groupType := g.Type()
+// Queues 获取所有的队列
+func (qm *Matcher) Queues() []*Queue {
+	return qm.queues
+}
+
+// State 获取匹配器当前状态
+func (qm *Matcher) State() MatcherState {
+	qm.Lock()
+	defer qm.Unlock()
+
+	return qm.state
+}
+
+// AddGroups 添加队伍，匹配器排空或停止后不再接收新的队伍，释放锁之后才通知队伍进入了队列
+func (qm *Matcher) AddGroups(gs ...Group) error {
+	targets, err := qm.addGroups(gs)
+	if err != nil {
+		return err
+	}
+	for i, g := range gs {
+		targets[i].observer.OnGroupEnqueued(targets[i].Name, g)
+	}
+	return nil
+}
+
+// addGroups 将队伍添加到各自的目标队列，返回每个队伍的目标队列
+func (qm *Matcher) addGroups(gs []Group) ([]*Queue, error) {
+	qm.Lock()
+	defer qm.Unlock()
+
+	if qm.state == MatcherStateDraining || qm.state == MatcherStateStopped {
+		return nil, ErrMatcherNotAccepting
+	}
+	// 先确定所有队伍的目标队列，有队伍找不到队列时一个都不添加
+	targets := make([]*Queue, len(gs))
+	for i, g := range gs {
+		name := qm.Router.Route(g)
+		q, ok := qm.queueMap[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q for group %s", ErrQueueNotFound, name, g.ID())
+		}
+		targets[i] = q
+	}
+
+	counts := make(map[*Queue]int)
+	for i, g := range gs {
+		q := targets[i]
+		if _, ok := counts[q]; !ok {
+			counts[q] = q.PlayerCount()
+		}
 		g.SetState(GroupStateQueuing)
-		if groupType == GroupTypeNotTeam {
-			qm.NormalQueue.AddGroups(g)
-		} else {
-			qm.TeamQueue.AddGroups(g)
+		q.AddGroups(g)
+	}
+
+	// 有队列的人数超过了触发阈值，则提前开始一轮匹配
+	for q, count := range counts {
+		if !q.reachTrigger(count) {
+			continue
+		}
+		select {
+		case qm.triggerChan <- struct{}{}:
+		default:
+		}
+		break
+	}
+	return targets, nil
+}
+
+// Start 异步启动匹配，ctx 取消后匹配循环退出，之后需要调用 Stop 取回还在排队的队伍
+func (qm *Matcher) Start(ctx context.Context) error {
+	qm.Lock()
+	defer qm.Unlock()
+
+	switch qm.state {
+	case MatcherStateIdle:
+	case MatcherStateStopped:
+		return ErrMatcherStopped
+	default:
+		return ErrMatcherStarted
+	}
+	qm.state = MatcherStateRunning
+	qm.started = true
+	go qm.run(ctx)
+	return nil
+}
+
+// Drain 停止接收新的队伍，但继续匹配已经在队列中的队伍，直到队列为空或者 ctx 结束。
+// 队列排空后匹配循环会自动退出；ctx 结束时返回 ctx.Err()，匹配循环会继续运行，直到调用 Stop。
+func (qm *Matcher) Drain(ctx context.Context) error {
+	qm.Lock()
+	switch qm.state {
+	case MatcherStateIdle:
+		qm.Unlock()
+		return ErrMatcherNotRunning
+	case MatcherStateStopped:
+		qm.Unlock()
+		return ErrMatcherStopped
+	}
+	qm.state = MatcherStateDraining
+	qm.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-qm.doneChan:
+		// 匹配循环退出后不会再有并发的匹配轮次，可以安全地检查临时阵营和临时房间
+		if !qm.isEmpty() {
+			return ErrMatcherStopped
 		}
+		return nil
 	}
 }
 
-func (qm *Matcher) Match() {
-	ticker := time.NewTicker(time.Second).C
+func (qm *Matcher) run(ctx context.Context) {
+	defer func() {
+		qm.Lock()
+		qm.state = MatcherStateStopped
+		qm.Unlock()
+		close(qm.doneChan)
+	}()
+
+	ticker := time.NewTicker(qm.TickInterval)
+	defer ticker.Stop()
+
+	// 距离上一轮匹配太近时，延迟到满足最小间隔后再匹配
+	var delay <-chan time.Time
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case <-qm.quitChan:
-			fmt.Println("\n\nGreceful exit...")
 			return
-		case <-ticker:
-			// 取出本轮要匹配的队伍
-			nGs := qm.NormalQueue.GetAndClearGroups()
-			tGs := qm.TeamQueue.GetAndClearGroups()
-
-			wg := sync.WaitGroup{}
-			wg.Add(2)
-			go func() {
-				nGs = qm.NormalQueue.Match(nGs)
-				wg.Done()
-			}()
-			go func() {
-				tGs = qm.TeamQueue.Match(tGs)
-				wg.Done()
-			}()
-			wg.Wait()
-
-			// 判断哪些 group 需要从专属队列从移动到普通队列
-			now := time.Now()
-			for _, g := range tGs {
-				needMove := false
-				matchTime := now.Unix() - g.GetStartMatchTimeSec()
-				switch g.Type() {
-				case GroupTypeMaliciousTeam:
-					if matchTime >= qm.TeamQueue.MaliciousTeamWaitTimeSec {
-						needMove = true
-					}
-				case GroupTypeUnfriendlyTeam:
-					if matchTime >= qm.TeamQueue.UnfriendlyTeamWaitTimeSec {
-						needMove = true
-					}
-				case GroupTypeNormalTeam:
-					if matchTime >= qm.TeamQueue.NormalTeamWaitTimeSec {
-						needMove = true
-					}
-				}
-				if needMove {
-					qm.NormalQueue.AddGroups(g)
-				} else {
-					qm.TeamQueue.AddGroups(g)
+		case <-ticker.C:
+		case <-qm.triggerChan:
+		case <-delay:
+			delay = nil
+		}
+
+		if wait := qm.MinRoundInterval - time.Since(qm.lastRound); wait > 0 {
+			if delay == nil {
+				delay = time.After(wait)
+			}
+			continue
+		}
+		delay = nil
+		qm.lastRound = time.Now()
+		qm.matchRound()
+
+		// 排空模式下，队列中没有队伍了就退出
+		if qm.State() == MatcherStateDraining && qm.isEmpty() {
+			return
+		}
+	}
+}
+
+// matchRound 进行一轮匹配
+func (qm *Matcher) matchRound() {
+	qm.roundMutex.Lock()
+	defer qm.roundMutex.Unlock()
+
+	// 取出本轮要匹配的队伍
+	left := make([][]Group, len(qm.queues))
+	for i, q := range qm.queues {
+		left[i] = q.GetAndClearGroups()
+	}
+
+	// 各个队列并发匹配
+	wg := sync.WaitGroup{}
+	wg.Add(len(qm.queues))
+	for i, q := range qm.queues {
+		go func(i int, q *Queue) {
+			left[i] = q.Match(left[i])
+			wg.Done()
+		}(i, q)
+	}
+	wg.Wait()
+
+	// 本轮没匹配成功的队伍，根据路由策略判断是否需要移动到别的队列，否则加回原队列下轮重新匹配
+	now := time.Now().Unix()
+	for i, q := range qm.queues {
+		for _, g := range left[i] {
+			target := q
+			if to, ok := qm.Router.Promote(q.Name, g, now-g.GetStartMatchTimeSec()); ok {
+				if tq, ok := qm.queueMap[to]; ok && tq != q {
+					target = tq
+					q.observer.OnGroupPromoted(q.Name, to, g)
 				}
 			}
+			target.AddGroups(g)
+		}
+	}
+
+	for _, q := range qm.queues {
+		if len(q.observer) != 0 {
+			q.observer.OnRoundFinished(q.Name, q.stat())
+		}
+	}
+}
 
-			// 将普通队列中上轮没成功匹配的加回去，下轮重新匹配
-			qm.NormalQueue.AddGroups(nGs...)
+// CancelGroup 取消队伍的匹配，会从所在队列的排队列表、临时阵营和临时房间中移除该队伍，
+// 被拆开的临时阵营和临时房间会留给其他队伍继续匹配。返回是否找到了该队伍。
+func (qm *Matcher) CancelGroup(groupID string, reason string) bool {
+	qm.roundMutex.Lock()
+	defer qm.roundMutex.Unlock()
 
-			fmt.Println("QueueName\t\tTmpTeam\t\tTmpRoom\t\tGroup\t\t")
-			fmt.Printf("%s\t\t%d\t\t%d\t\t%d\t\t\n", qm.NormalQueue.Name, len(qm.NormalQueue.tmpTeam),
-				len(qm.NormalQueue.tmpRoom), len(qm.NormalQueue.Groups))
-			fmt.Printf("%s\t\t%d\t\t%d\t\t%d\t\t\n", qm.TeamQueue.Name, len(qm.TeamQueue.tmpTeam),
-				len(qm.TeamQueue.tmpRoom), len(qm.TeamQueue.Groups))
-			fmt.Println()
+	for _, q := range qm.queues {
+		g, ok := q.removeGroup(groupID)
+		if !ok {
+			continue
+		}
+		if g.GetState() == GroupStateQueuing {
+			for _, p := range g.Players() {
+				if !p.IsAi() {
+					p.ForceCancelMatch(reason)
+				}
+			}
+			g.SetState(GroupStateUnready)
+		}
+		return true
+	}
+	return false
+}
+
+// isEmpty 判断所有队列是否都已经没有队伍了，不可以与匹配轮次并发调用
+func (qm *Matcher) isEmpty() bool {
+	for _, q := range qm.queues {
+		if !q.isEmpty() {
+			return false
 		}
 	}
+	return true
 }
 
-func (qm *Matcher) Stop() ([]Group, []Group) {
-	gs1 := qm.NormalQueue.stopMatch()
-	gs2 := qm.TeamQueue.stopMatch()
-	qm.quitChan <- struct{}{}
-	return gs1, gs2
+// Stop 停止匹配，并按队列名称返回所有还在排队中的队伍（包括临时阵营和临时房间中的）。
+// Stop 最多等待正在进行的一轮匹配结束，可以重复调用，重复调用时返回空。
+func (qm *Matcher) Stop() map[string][]Group {
+	res := make(map[string][]Group, len(qm.queues))
+	qm.stopOnce.Do(func() {
+		qm.Lock()
+		started := qm.started
+		qm.state = MatcherStateStopped
+		qm.Unlock()
+
+		close(qm.quitChan)
+		if started {
+			<-qm.doneChan
+		}
+		for _, q := range qm.queues {
+			res[q.Name] = q.stopMatch()
+		}
+	})
+	return res
 }
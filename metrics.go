@@ -0,0 +1,266 @@
+package glicko2
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// 匹配时长的分桶(s)
+	waitSecBuckets = []float64{1, 2, 5, 10, 15, 20, 30, 60, 120, 300}
+	// 每轮匹配成功的房间数的分桶
+	roundRoomsBuckets = []float64{0, 1, 2, 5, 10, 20, 50, 100}
+	// 每轮匹配耗时的分桶(s)
+	roundDurationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+)
+
+// Metrics 是内置的匹配指标收集器，按队列统计匹配的健康状况。
+// 它实现了 MatcherObserver，加入 MatcherArgs.Observers 即可开始收集；
+// 同时实现了 http.Handler，以 Prometheus 文本格式暴露指标。
+type Metrics struct {
+	sync.Mutex
+	queues map[string]*queueMetrics
+}
+
+// queueMetrics 是单个队列的指标
+type queueMetrics struct {
+	// gauge
+	groups   float64
+	players  float64
+	tmpTeams float64
+	tmpRooms float64
+
+	// counter
+	enqueued float64
+	timeouts float64
+	promoted float64
+	rooms    float64
+	aiRooms  float64
+
+	// histogram
+	waitSec       *histogram
+	roundRooms    *histogram
+	roundDuration *histogram
+}
+
+type metricDesc struct {
+	name  string
+	help  string
+	typ   string
+	value func(m *queueMetrics) float64
+	hist  func(m *queueMetrics) *histogram
+}
+
+var metricDescs = []metricDesc{
+	{name: "glicko2_queue_groups", help: "Groups waiting in the queue.", typ: "gauge",
+		value: func(m *queueMetrics) float64 { return m.groups }},
+	{name: "glicko2_queue_players", help: "Players waiting in the queue.", typ: "gauge",
+		value: func(m *queueMetrics) float64 { return m.players }},
+	{name: "glicko2_queue_tmp_teams", help: "Temporary teams kept in the queue.", typ: "gauge",
+		value: func(m *queueMetrics) float64 { return m.tmpTeams }},
+	{name: "glicko2_queue_tmp_rooms", help: "Temporary rooms kept in the queue.", typ: "gauge",
+		value: func(m *queueMetrics) float64 { return m.tmpRooms }},
+	{name: "glicko2_groups_enqueued_total", help: "Groups that started matching in the queue.", typ: "counter",
+		value: func(m *queueMetrics) float64 { return m.enqueued }},
+	{name: "glicko2_group_timeouts_total", help: "Groups that timed out in the queue.", typ: "counter",
+		value: func(m *queueMetrics) float64 { return m.timeouts }},
+	{name: "glicko2_group_promotions_total", help: "Groups promoted out of the queue.", typ: "counter",
+		value: func(m *queueMetrics) float64 { return m.promoted }},
+	{name: "glicko2_rooms_total", help: "Rooms matched in the queue.", typ: "counter",
+		value: func(m *queueMetrics) float64 { return m.rooms }},
+	{name: "glicko2_ai_rooms_total", help: "Rooms matched in the queue with AI filled in.", typ: "counter",
+		value: func(m *queueMetrics) float64 { return m.aiRooms }},
+	{name: "glicko2_ai_fill_ratio", help: "Share of matched rooms with AI filled in.", typ: "gauge",
+		value: func(m *queueMetrics) float64 {
+			if m.rooms == 0 {
+				return 0
+			}
+			return m.aiRooms / m.rooms
+		}},
+	{name: "glicko2_match_wait_seconds", help: "Time groups waited before being matched.", typ: "histogram",
+		hist: func(m *queueMetrics) *histogram { return m.waitSec }},
+	{name: "glicko2_round_rooms", help: "Rooms matched per matching round.", typ: "histogram",
+		hist: func(m *queueMetrics) *histogram { return m.roundRooms }},
+	{name: "glicko2_round_duration_seconds", help: "Duration of a matching round.", typ: "histogram",
+		hist: func(m *queueMetrics) *histogram { return m.roundDuration }},
+}
+
+var _ MatcherObserver = (*Metrics)(nil)
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		queues: make(map[string]*queueMetrics),
+	}
+}
+
+// queue 获取队列的指标，需要持有锁
+func (m *Metrics) queue(name string) *queueMetrics {
+	qm, ok := m.queues[name]
+	if !ok {
+		qm = &queueMetrics{
+			waitSec:       newHistogram(waitSecBuckets),
+			roundRooms:    newHistogram(roundRoomsBuckets),
+			roundDuration: newHistogram(roundDurationBuckets),
+		}
+		m.queues[name] = qm
+	}
+	return qm
+}
+
+func (m *Metrics) OnGroupEnqueued(queue string, _ Group) {
+	m.Lock()
+	defer m.Unlock()
+	m.queue(queue).enqueued++
+}
+
+func (m *Metrics) OnGroupTimeout(queue string, _ Group) {
+	m.Lock()
+	defer m.Unlock()
+	m.queue(queue).timeouts++
+}
+
+func (m *Metrics) OnGroupPromoted(from, _ string, _ Group) {
+	m.Lock()
+	defer m.Unlock()
+	m.queue(from).promoted++
+}
+
+func (m *Metrics) OnTeamFormed(string, Team)       {}
+func (m *Metrics) OnRoomFormed(string, Room)       {}
+func (m *Metrics) OnAiRoomCreated(string, Room)    {}
+func (m *Metrics) OnTmpReshuffled(string, []Group) {}
+
+func (m *Metrics) OnRoomEmitted(res MatchResult) {
+	m.Lock()
+	defer m.Unlock()
+
+	qm := m.queue(res.QueueName)
+	qm.rooms++
+	if res.HasAi {
+		qm.aiRooms++
+	}
+	for _, sec := range res.GroupWaitSec {
+		qm.waitSec.observe(float64(sec))
+	}
+}
+
+func (m *Metrics) OnRoundFinished(queue string, stat QueueStat) {
+	m.Lock()
+	defer m.Unlock()
+
+	qm := m.queue(queue)
+	qm.groups = float64(stat.Groups)
+	qm.players = float64(stat.Players)
+	qm.tmpTeams = float64(stat.TmpTeams)
+	qm.tmpRooms = float64(stat.TmpRooms)
+	qm.roundRooms.observe(float64(stat.Rooms))
+	qm.roundDuration.observe(stat.Duration.Seconds())
+}
+
+// WriteTo 以 Prometheus 文本格式输出所有指标
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	names := make([]string, 0, len(m.queues))
+	for name := range m.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	for _, desc := range metricDescs {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n", desc.name, desc.help, desc.name, desc.typ)
+		for _, name := range names {
+			label := `queue="` + escapeLabel(name) + `"`
+			qm := m.queues[name]
+			if desc.hist == nil {
+				fmt.Fprintf(cw, "%s{%s} %s\n", desc.name, label, formatFloat(desc.value(qm)))
+				continue
+			}
+			h := desc.hist(qm)
+			cumulative := uint64(0)
+			for i, b := range h.buckets {
+				cumulative += h.counts[i]
+				fmt.Fprintf(cw, "%s_bucket{%s,le=\"%s\"} %d\n", desc.name, label, formatFloat(b), cumulative)
+			}
+			fmt.Fprintf(cw, "%s_bucket{%s,le=\"+Inf\"} %d\n", desc.name, label, h.count)
+			fmt.Fprintf(cw, "%s_sum{%s} %s\n", desc.name, label, formatFloat(h.sum))
+			fmt.Fprintf(cw, "%s_count{%s} %d\n", desc.name, label, h.count)
+		}
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// ServeHTTP 以 Prometheus 文本格式暴露指标
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// histogram 是一个固定分桶的直方图，counts[i] 为落在 (buckets[i-1], buckets[i]] 中的个数
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	h.sum += v
+	h.count++
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		h.counts[i]++
+	}
+}
+
+// countWriter 记录写入的字节数和第一个错误
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
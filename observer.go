@@ -0,0 +1,118 @@
+package glicko2
+
+import (
+	"time"
+)
+
+// MatcherObserver 观察匹配过程中的事件。
+// 所有方法都在匹配流程中同步调用，并且不同队列的事件会并发触发，实现时需要并发安全且不能阻塞。
+// 调用时不持有 Matcher 和 Queue 的锁，可以在方法中查询队列状态（如 Queue.PlayerCount）。
+type MatcherObserver interface {
+
+	// 队伍开始匹配，进入了 queue 队列
+	OnGroupEnqueued(queue string, g Group)
+
+	// 队伍匹配超时
+	OnGroupTimeout(queue string, g Group)
+
+	// 队伍从 from 队列移动到了 to 队列
+	OnGroupPromoted(from, to string, g Group)
+
+	// 组成了新的临时阵营
+	OnTeamFormed(queue string, t Team)
+
+	// 组成了新的临时房间
+	OnRoomFormed(queue string, r Room)
+
+	// 填充 ai 组成了新的房间
+	OnAiRoomCreated(queue string, r Room)
+
+	// 临时阵营和临时房间被打散，groups 为打散后放回队列的队伍
+	OnTmpReshuffled(queue string, groups []Group)
+
+	// 房间匹配成功，投递给了使用方
+	OnRoomEmitted(res MatchResult)
+
+	// 一轮匹配结束
+	OnRoundFinished(queue string, stat QueueStat)
+}
+
+// QueueStat 是一轮匹配结束后队列的状态
+type QueueStat struct {
+	Groups   int           // 在队列中排队的队伍数
+	Players  int           // 在队列中排队的玩家数
+	TmpTeams int           // 临时阵营数
+	TmpRooms int           // 临时房间数
+	Rooms    int           // 本轮匹配成功的房间数
+	Duration time.Duration // 本轮匹配耗时
+}
+
+// NopObserver 是一个什么都不做的 MatcherObserver，可以嵌入到只关心部分事件的观察者中
+type NopObserver struct{}
+
+func (NopObserver) OnGroupEnqueued(string, Group)         {}
+func (NopObserver) OnGroupTimeout(string, Group)          {}
+func (NopObserver) OnGroupPromoted(string, string, Group) {}
+func (NopObserver) OnTeamFormed(string, Team)             {}
+func (NopObserver) OnRoomFormed(string, Room)             {}
+func (NopObserver) OnAiRoomCreated(string, Room)          {}
+func (NopObserver) OnTmpReshuffled(string, []Group)       {}
+func (NopObserver) OnRoomEmitted(MatchResult)             {}
+func (NopObserver) OnRoundFinished(string, QueueStat)     {}
+
+// observers 将事件依次分发给多个观察者
+type observers []MatcherObserver
+
+func (os observers) OnGroupEnqueued(queue string, g Group) {
+	for _, o := range os {
+		o.OnGroupEnqueued(queue, g)
+	}
+}
+
+func (os observers) OnGroupTimeout(queue string, g Group) {
+	for _, o := range os {
+		o.OnGroupTimeout(queue, g)
+	}
+}
+
+func (os observers) OnGroupPromoted(from, to string, g Group) {
+	for _, o := range os {
+		o.OnGroupPromoted(from, to, g)
+	}
+}
+
+func (os observers) OnTeamFormed(queue string, t Team) {
+	for _, o := range os {
+		o.OnTeamFormed(queue, t)
+	}
+}
+
+func (os observers) OnRoomFormed(queue string, r Room) {
+	for _, o := range os {
+		o.OnRoomFormed(queue, r)
+	}
+}
+
+func (os observers) OnAiRoomCreated(queue string, r Room) {
+	for _, o := range os {
+		o.OnAiRoomCreated(queue, r)
+	}
+}
+
+func (os observers) OnTmpReshuffled(queue string, groups []Group) {
+	for _, o := range os {
+		o.OnTmpReshuffled(queue, groups)
+	}
+}
+
+func (os observers) OnRoomEmitted(res MatchResult) {
+	for _, o := range os {
+		o.OnRoomEmitted(res)
+	}
+}
+
+func (os observers) OnRoundFinished(queue string, stat QueueStat) {
+	for _, o := range os {
+		o.OnRoundFinished(queue, stat)
+	}
+}
@@ -0,0 +1,44 @@
+package glicko2
+
+// PlacementPlayer 是有定级阶段的玩家：新赛季、新玩家或回流玩家需要先完成若干局定级对局，
+// 定级期间匹配使用 PlacementMMR（如上赛季的 mmr 或保护分），Settler 会放大定级期间的 mmr 变化
+type PlacementPlayer interface {
+
+	// 需要完成的定级对局数，0 表示不需要定级
+	PlacementGames() int
+
+	// 已完成的定级对局数
+	GetPlayedPlacementGames() int
+	SetPlayedPlacementGames(games int)
+
+	// 定级期间匹配使用的 mmr
+	PlacementMMR() float64
+
+	// 开始定级：需要完成 games 局定级对局，期间按 mmr 匹配，已完成的定级对局数清零。
+	// 如赛季初 StartPlacement(5, 上赛季的 mmr)（见 SeasonRecord.StartPlacement），新玩家和回流玩家 StartPlacement(10, 保护分)
+	StartPlacement(games int, mmr float64)
+}
+
+// InPlacement 判断玩家是否在定级期间
+func InPlacement(p Player) bool {
+	pp, ok := p.(PlacementPlayer)
+	return ok && !p.IsAi() && pp.GetPlayedPlacementGames() < pp.PlacementGames()
+}
+
+// MatchingMMR 获取玩家匹配使用的 mmr，定级期间为 PlacementMMR，否则为 MMR。Group.MMR 的实现应该使用该值
+func MatchingMMR(p Player) float64 {
+	if InPlacement(p) {
+		return p.(PlacementPlayer).PlacementMMR()
+	}
+	return p.MMR()
+}
+
+// countPlacement 为定级期间的玩家增加一局已完成的定级对局
+func countPlacement(players []Player) {
+	for _, p := range players {
+		if InPlacement(p) {
+			pp := p.(PlacementPlayer)
+			pp.SetPlayedPlacementGames(pp.GetPlayedPlacementGames() + 1)
+		}
+	}
+}
@@ -47,3 +47,37 @@ type Player interface {
 	// glicko-2 算法的玩家抽象示例
 	GlickoPlayer() *glicko.Player
 }
+
+// PerformancePlayer 是可以提供赛后个人表现分（如击杀、伤害、目标分）的玩家，
+// Settler 会根据双方表现分的占比计算出 0~1 之间的对局结果
+type PerformancePlayer interface {
+
+	// 赛后的个人表现分，不能为负数，第二个返回值表示是否有表现分
+	Performance() (float64, bool)
+}
+
+// ActivityPlayer 是可以记录参数最近一次更新到的时间的玩家，Settler 结算时会更新该时间，
+// 并根据该时间计算玩家不活跃期间评分偏差的增长，见 Settler.ApplyInactivity
+type ActivityPlayer interface {
+
+	// 参数最近一次更新到的时间，0 表示未知
+	GetRatedTimeSec() int64
+	SetRatedTimeSec(t int64)
+}
+
+// Participation 玩家在一局游戏中的参与状态
+type Participation uint8
+
+const (
+	ParticipationCompleted Participation = iota // 完整参与了对局
+	ParticipationLeft                           // 中途退出
+	ParticipationAfk                            // 挂机
+	ParticipationLate                           // 中途加入或断线后很晚才重连
+)
+
+// ParticipationPlayer 是可以提供赛后参与状态的玩家，没有实现的玩家视为完整参与了对局
+type ParticipationPlayer interface {
+
+	// 赛后的参与状态，以及参与了对局的比例(0~1)，比例只对 ParticipationLate 生效
+	Participation() (Participation, float64)
+}
@@ -0,0 +1,87 @@
+package glicko2
+
+import (
+	"math"
+)
+
+// Quality 是一个房间的匹配质量
+type Quality struct {
+	TeamExpected     []float64 // 每个阵营对其他阵营的平均期望得分(0~1)，顺序与 Room.Teams() 一致，没有真人玩家的阵营为 0
+	Favorite         int       // 期望得分最高的阵营下标，没有可比较的阵营时为 -1
+	FavoriteExpected float64   // 期望得分最高的阵营的期望得分，两个阵营时即为其胜率
+}
+
+// MatchQuality 使用 glicko-2 考虑了评分偏差的期望得分公式计算房间中每个阵营的期望得分，
+// 阵营的评分和评分偏差由阵营中的真人玩家合成，ai 玩家不参与计算。使用默认的评分尺度，见 RatingSystem.MatchQuality
+func MatchQuality(room Room) Quality {
+	return RatingSystem{}.MatchQuality(room)
+}
+
+// teamsQuality 计算一组阵营的匹配质量，需要先填充默认值
+func (rs RatingSystem) teamsQuality(teams []Team) Quality {
+	res := Quality{
+		TeamExpected: make([]float64, len(teams)),
+		Favorite:     -1,
+	}
+
+	mus := make([]float64, len(teams))
+	phis := make([]float64, len(teams))
+	rated := make([]bool, len(teams))
+	for i, t := range teams {
+		mus[i], phis[i], rated[i] = rs.teamRating(t)
+	}
+
+	for i := range teams {
+		if !rated[i] {
+			continue
+		}
+		total, count := 0.0, 0
+		for j := range teams {
+			if i == j || !rated[j] {
+				continue
+			}
+			total += expectedScore(mus[i], mus[j], math.Sqrt(phis[i]*phis[i]+phis[j]*phis[j]))
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+		res.TeamExpected[i] = total / float64(count)
+		if res.Favorite == -1 || res.TeamExpected[i] > res.FavoriteExpected {
+			res.Favorite = i
+			res.FavoriteExpected = res.TeamExpected[i]
+		}
+	}
+	return res
+}
+
+// teamRating 合成阵营在 glicko-2 尺度下的评分和评分偏差：
+// 评分取真人玩家匹配使用的 mmr（见 MatchingMMR）的平均值，与 MMRGapPercent 的检查一致，评分偏差取真人玩家评分偏差的均方根
+func (rs RatingSystem) teamRating(t Team) (mu, phi float64, ok bool) {
+	count := 0
+	for _, g := range t.Groups() {
+		for _, p := range g.Players() {
+			if p.IsAi() {
+				continue
+			}
+			m, f := rs.toGlickoScale(MatchingMMR(p), p.GetArgs().DR)
+			mu += m
+			phi += f * f
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, 0, false
+	}
+	return mu / float64(count), math.Sqrt(phi / float64(count)), true
+}
+
+// expectedScore 是 glicko-2 的期望得分公式，phi 为对手（或双方合成）的评分偏差
+func expectedScore(mu, muJ, phi float64) float64 {
+	return 1 / (1 + math.Exp(-glickoG(phi)*(mu-muJ)))
+}
+
+// glickoG 是 glicko-2 中按评分偏差降低对局权重的 g 函数
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
@@ -12,6 +12,7 @@ const (
 	refreshTurn = 5
 
 	CancelMatchByServerStop = "Failed to match. Please try again later"
+	CancelMatchByUser       = "Matching cancelled"
 	CancelMatchByTimeout    = "No team found, please try again later"
 )
 
@@ -20,13 +21,17 @@ type Queue struct {
 	sync.Mutex
 	Name          string               // 队列名称
 	Groups        []Group              // 在队列中的队伍，对于 Groups 的所有处理都要加锁
-	tmpTeam       []Team               // 匹配过程中的临时阵营，每 5 轮匹配后会打散重来，只能在 Match 中调用，不可以并发调用
-	tmpRoom       []Room               // 匹配过程中的临时房间，每 5 轮匹配后会打散重来，只能在 Match 中调用，不可以并发调用
+	tmpTeam       []Team               // 匹配过程中的临时阵营，每 5 轮匹配后会打散重来，不可以与 Match 并发调用
+	tmpRoom       []Room               // 匹配过程中的临时房间，每 5 轮匹配后会打散重来，不可以与 Match 并发调用
 	roomChan      chan Room            // 匹配成功的房间会投进这个 channel
+	resultChan    chan MatchResult     // 匹配成功的房间的匹配结果会投进这个 channel，为空时不投递
+	observer      observers            // 匹配事件的观察者
 	newTeam       func() Team          // 构建新 team 的方法
 	newRoom       func() Room          // 构建新 room 的方法
 	newRoomWithAi func(team Team) Room // 构建带 ai 的新 room 的方法
 	matchTurn     int                  // 匹配轮次，对 5 取模
+	roundRooms    int                  // 上一轮匹配成功的房间数
+	roundDuration time.Duration        // 上一轮匹配的耗时
 
 	QueueArgs
 }
@@ -42,7 +47,21 @@ type QueueArgs struct {
 	UnfriendlyTeamWaitTimeSec int64 // 不友好车队在专属队列中的匹配时长
 	MaliciousTeamWaitTimeSec  int64 // 恶意车队在专属队列中的匹配时长
 
-	MatchRanges []MatchRange // 匹配范围策略
+	MatchRanges  []MatchRange  // 匹配范围策略
+	Strategy     MatchStrategy // 匹配策略，为空时使用 GreedyStrategy
+	RatingSystem RatingSystem  // 计算 MatchRange.MaxWinProbability 时使用的评分尺度，应与 Settler 的一致
+
+	TriggerPlayerCount int // 新加入的队伍使队列中的玩家数达到该值时提前触发一轮匹配，0 表示不开启
+
+	// 包含评分偏差不低于 UncertainDR 的真人玩家（如长期不活跃后回流的玩家）的队伍、阵营和房间，
+	// 计算匹配范围时视为多匹配了 UncertainWaitSec 秒，从而使用更宽的 MatchRange，任意一个为 0 表示不开启
+	UncertainDR      float64
+	UncertainWaitSec int64
+
+	// 包含连败不少于 LosingStreak 局的真人玩家（见 StreakPlayer）的队伍、阵营和房间，
+	// 计算匹配范围时视为多匹配了 LosingStreakWaitSec 秒，更快地放宽匹配范围。与 UncertainWaitSec 同时满足时取较大的一个，任意一个为 0 表示不开启
+	LosingStreak        int
+	LosingStreakWaitSec int64
 }
 
 type MatchRange struct {
@@ -50,6 +69,8 @@ type MatchRange struct {
 	MMRGapPercent int   // 允许的 mmr 差距百分比(0~100)（包含），0 表示无限制
 	CanJoinTeam   bool  // 是否加入 5 人车队
 	StarGap       int   // 允许的段位差距数（包含），0 表示无限制
+
+	MaxWinProbability float64 // 允许的最强阵营的期望胜率(0.5~1)（包含），0 表示无限制，见 MatchQuality
 }
 
 var defaultMatchRange = MatchRange{
@@ -95,6 +116,26 @@ func (q *Queue) AllGroups() []Group {
 	return q.Groups
 }
 
+// PlayerCount 获取在队列中排队的玩家数，不包含临时阵营和临时房间中的玩家
+func (q *Queue) PlayerCount() int {
+	q.Lock()
+	defer q.Unlock()
+
+	count := 0
+	for _, g := range q.Groups {
+		count += len(g.Players())
+	}
+	return count
+}
+
+// reachTrigger 判断队列人数是否从 before 增加到了触发阈值
+func (q *Queue) reachTrigger(before int) bool {
+	if q.TriggerPlayerCount <= 0 || before >= q.TriggerPlayerCount {
+		return false
+	}
+	return q.PlayerCount() >= q.TriggerPlayerCount
+}
+
 func (q *Queue) AddGroups(gs ...Group) {
 	q.Lock()
 	defer q.Unlock()
@@ -107,12 +148,22 @@ func (q *Queue) AddGroups(gs ...Group) {
 	q.Groups = append(q.Groups, gs...)
 }
 
-// GetAndClearGroups 取出要匹配的 group 并且清空当前 groups 列表
+// GetAndClearGroups 取出要匹配的 group 并且清空当前 groups 列表，释放锁之后才通知超时的队伍
 func (q *Queue) GetAndClearGroups() []Group {
+	res, timeouts := q.getAndClearGroups()
+	for _, g := range timeouts {
+		q.observer.OnGroupTimeout(q.Name, g)
+	}
+	return res
+}
+
+// getAndClearGroups 取出要匹配的 group 和超时的 group，并且清空当前 groups 列表
+func (q *Queue) getAndClearGroups() ([]Group, []Group) {
 	q.Lock()
 	defer q.Unlock()
 
 	now := time.Now().Unix()
+	var timeouts []Group
 	res := make([]Group, 0, len(q.Groups))
 	for _, g := range q.Groups {
 		// 只要还在匹配中的队伍
@@ -124,13 +175,14 @@ func (q *Queue) GetAndClearGroups() []Group {
 					go tmpP.ForceCancelMatch(CancelMatchByTimeout)
 				}
 				g.SetState(GroupStateUnready)
+				timeouts = append(timeouts, g)
 				continue
 			}
 			res = append(res, g)
 		}
 	}
 	q.Groups = make([]Group, 0, 128)
-	return res
+	return res, timeouts
 }
 
 // clearTmp 清除 tmpRoom 和 tmpTeam 并归位 groups
@@ -151,289 +203,270 @@ func (q *Queue) clearTmp() []Group {
 
 // Match 队列匹配逻辑
 func (q *Queue) Match(groups []Group) []Group {
-	var tmpTeam = q.tmpTeam
-	var tmpRoom = q.tmpRoom
-
-	sort.Slice(groups, func(i, j int) bool {
-		return groups[i].MMR() < groups[j].MMR()
-	})
-
-	// 获取所有的玩家个数
-	totalPlayerCount := 0
-	for _, g := range groups {
-		totalPlayerCount += len(g.Players())
-	}
-	for _, t := range tmpTeam {
-		totalPlayerCount += t.PlayerCount()
+	start := time.Now()
+	prev := MatchState{
+		TmpTeam: append([]Team(nil), q.tmpTeam...),
+		TmpRoom: append([]Room(nil), q.tmpRoom...),
 	}
-	for _, r := range tmpRoom {
-		totalPlayerCount += r.PlayerCount()
-	}
-
-	sort.Slice(tmpTeam, func(i, j int) bool {
-		return tmpTeam[i].AverageMMR() < tmpTeam[j].AverageMMR()
+	rooms, left := q.strategy().Match(q, MatchState{
+		Groups:  groups,
+		TmpTeam: q.tmpTeam,
+		TmpRoom: q.tmpRoom,
 	})
+	if len(q.observer) != 0 {
+		q.notifyFormed(prev, rooms, left)
+	}
 
-	// 尝试构建 totalPlayerCount/RoomPlayerLimit + 1 个 room
-	for k := 0; k < totalPlayerCount/q.RoomPlayerLimit+1; k++ {
-		// 优先把 tmp team 填满
-		for _, tt := range tmpTeam {
-			for tt.PlayerCount() != q.TeamPlayerLimit {
-				var found bool
-				groups, found = q.findGroupForTeam(tt, groups)
-				if !found {
-					break
-				}
-			}
-		}
-
-		// 获取还在队列中的玩家数，尝试构建新的 team
-		notInTeamPlayerCount := 0
-		for _, g := range groups {
-			notInTeamPlayerCount += len(g.Players())
-		}
-
-		// 再去构建新的 team
-		for i := 0; i < notInTeamPlayerCount/q.TeamPlayerLimit+1; i++ {
-			team := q.newTeam()
-			for team.PlayerCount() != q.TeamPlayerLimit {
-				var found bool
-				groups, found = q.findGroupForTeam(team, groups)
-				if !found {
-					break
-				}
-			}
-			if team.PlayerCount() == 0 {
-				break
-			}
-			tmpTeam = append(tmpTeam, team)
-		}
-
-		// 优先在 tmpRoom 中创建房间
-		for _, tr := range tmpRoom {
-			if len(tr.Teams()) == q.RoomTeamLimit {
-				continue
-			}
-			for len(tr.Teams()) != q.RoomTeamLimit {
-				var found bool
-				tmpTeam, found = q.findTeamForRoom(tr, tmpTeam)
-				if !found {
-					break
-				}
-			}
-		}
-
-		// 尝试继续创建新的房间
-		tryRoomTimes := len(tmpTeam) / q.RoomTeamLimit
-		for l := 0; l < tryRoomTimes+1; l++ {
-			room := q.newRoom()
-			for len(room.Teams()) != q.RoomTeamLimit {
-				var found bool
-				tmpTeam, found = q.findTeamForRoom(room, tmpTeam)
-				if !found {
-					break
-				}
-			}
-			if len(room.Teams()) == 0 {
-				break
-			}
-			tmpRoom = append(tmpRoom, room)
-		}
-
-		// 尝试填充 ai
-		for _, tr := range tmpRoom {
-			teams := tr.Teams()
-			if len(teams) == 0 || len(teams) == q.RoomTeamLimit {
-				continue
-			}
-			for _, team := range teams {
-				canFillAi := true
-				for _, g := range tr.Teams()[0].Groups() {
-					if !g.CanFillAi() {
-						canFillAi = false
-						break
-					}
-				}
-				if !canFillAi {
-					continue
-				}
-				tr.RemoveTeam(team)
-				newRoom := q.newRoomWithAi(team)
-				tmpRoom = append(tmpRoom, newRoom)
-			}
+	now := time.Now().Unix()
+	for _, room := range rooms {
+		room.SetFinishMatchTimeSec(now)
+		go func(room Room) {
+			q.roomChan <- room
+		}(room)
+		if q.resultChan == nil && len(q.observer) == 0 {
+			continue
 		}
-
-		// 整理房间信息
-		newTmpRoom := make([]Room, 0)
-		for _, tr := range tmpRoom {
-			if len(tr.Teams()) == q.RoomTeamLimit {
-				now := time.Now().Unix()
-				tr.SetFinishMatchTimeSec(now)
-				go func(room Room) {
-					q.roomChan <- room
-				}(tr)
-				continue
-			}
-			newTmpRoom = append(newTmpRoom, tr)
+		res := q.newMatchResult(room, now)
+		q.observer.OnRoomEmitted(res)
+		if q.resultChan != nil {
+			go func(res MatchResult) {
+				q.resultChan <- res
+			}(res)
 		}
-		tmpRoom = newTmpRoom
 	}
 
 	// 每 refreshTurn 轮都打散重来
+	groups = left.Groups
+	q.tmpTeam = left.TmpTeam
+	q.tmpRoom = left.TmpRoom
 	q.matchTurn = (q.matchTurn + 1) % refreshTurn
 	if q.matchTurn == 0 {
 		gs := q.clearTmp()
+		q.observer.OnTmpReshuffled(q.Name, gs)
 		groups = append(groups, gs...)
-	} else {
-		q.tmpTeam = tmpTeam
-		q.tmpRoom = tmpRoom
 	}
+	q.roundRooms = len(rooms)
+	q.roundDuration = time.Since(start)
 
 	// TODO: 谨慎考虑匹配一般玩家取消匹配的参加
 	return groups
 }
 
-// findGroupForTeam 从 groups 中找到适合 team 的 group 并加入其中
-func (q *Queue) findGroupForTeam(team Team, groups []Group) ([]Group, bool) {
-	// 第1个队伍直接进
-	if team.PlayerCount() == 0 && len(groups) > 0 {
-		team.AddGroup(groups[0])
-		groups = groups[1:]
-		return groups, true
+// notifyFormed 对比匹配前后的临时状态，通知新组成的阵营和房间
+func (q *Queue) notifyFormed(prev MatchState, rooms []Room, left MatchState) {
+	prevTeams := make(map[Team]struct{})
+	prevRooms := make(map[Room]struct{})
+	for _, t := range prev.TmpTeam {
+		prevTeams[t] = struct{}{}
+	}
+	for _, r := range prev.TmpRoom {
+		prevRooms[r] = struct{}{}
+		for _, t := range r.Teams() {
+			prevTeams[t] = struct{}{}
+		}
 	}
 
-	// 寻找平均 mmr 最接近的 group 组成一个 team
-	closestIndex := -1
-	for i, group := range groups {
-		// 优先找能凑满队的
-		if team.PlayerCount()+len(group.Players()) == q.TeamPlayerLimit && (closestIndex == -1 || math.Abs(group.MMR()-team.AverageMMR()) < math.Abs(groups[closestIndex].MMR()-team.AverageMMR())) {
-			closestIndex = i
+	newTeam := func(t Team) {
+		if _, ok := prevTeams[t]; ok || t.IsAi() {
+			return
 		}
+		prevTeams[t] = struct{}{}
+		q.observer.OnTeamFormed(q.Name, t)
 	}
-	if closestIndex == -1 {
-		// 不能一次性组满队，就先临时组一个队，后面再尝试组满
-		for i, group := range groups {
-			if team.PlayerCount()+len(group.Players()) <= q.TeamPlayerLimit && (closestIndex == -1 || math.Abs(group.MMR()-team.AverageMMR()) < math.Abs(groups[closestIndex].MMR()-team.AverageMMR())) {
-				closestIndex = i
-			}
+	for _, t := range left.TmpTeam {
+		newTeam(t)
+	}
+	for _, r := range append(append([]Room(nil), rooms...), left.TmpRoom...) {
+		for _, t := range r.Teams() {
+			newTeam(t)
 		}
-		// 如果没有找到合适的 group，则直接返回，这里一般是因为 group 列表为空
-		if closestIndex == -1 {
-			return groups, false
+		if _, ok := prevRooms[r]; ok {
+			continue
+		}
+		if r.HasAi() {
+			q.observer.OnAiRoomCreated(q.Name, r)
+		} else {
+			q.observer.OnRoomFormed(q.Name, r)
 		}
 	}
+}
 
-	if q.canGroupTogether(team, groups[closestIndex]) {
-		team.AddGroup(groups[closestIndex])
-		groups = append(groups[:closestIndex], groups[closestIndex+1:]...)
-		return groups, true
+// stat 获取一轮匹配结束后队列的状态，不可以与 Match 并发调用
+func (q *Queue) stat() QueueStat {
+	q.Lock()
+	defer q.Unlock()
+
+	players := 0
+	for _, g := range q.Groups {
+		players += len(g.Players())
 	}
+	return QueueStat{
+		Groups:   len(q.Groups),
+		Players:  players,
+		TmpTeams: len(q.tmpTeam),
+		TmpRooms: len(q.tmpRoom),
+		Rooms:    q.roundRooms,
+		Duration: q.roundDuration,
+	}
+}
 
-	return groups, false
+// strategy 获取队列的匹配策略
+func (q *Queue) strategy() MatchStrategy {
+	if q.Strategy == nil {
+		return GreedyStrategy{}
+	}
+	return q.Strategy
 }
 
-// findTeamForRoom 从 tmpTeam 中找到合适 room 的 team 并加入其中
-func (q *Queue) findTeamForRoom(room Room, tmpTeam []Team) ([]Team, bool) {
-	for tPos, tt := range tmpTeam {
-		if len(room.Teams()) >= q.RoomTeamLimit {
-			break
-		}
-		// 只有当 team 已经组建完毕了，才可以加入到 room 中
-		if tt.PlayerCount() != q.TeamPlayerLimit {
-			continue
-		}
-		// 如果 room 中没有 team，则第 1 个直接加入 room 中
-		if len(room.Teams()) == 0 {
-			room.AddTeam(tt)
-			tmpTeam = append(tmpTeam[:tPos], tmpTeam[tPos+1:]...)
-			return tmpTeam, true
-		} else {
-			if q.canTeamTogether(room, tt) {
-				room.AddTeam(tt)
-				tmpTeam = append(tmpTeam[:tPos], tmpTeam[tPos+1:]...)
-				return tmpTeam, true
+// NewTeam 构建新的阵营
+func (q *Queue) NewTeam() Team {
+	return q.newTeam()
+}
+
+// NewRoom 构建新的房间
+func (q *Queue) NewRoom() Room {
+	return q.newRoom()
+}
+
+// NewRoomWithAi 以 team 为基础构建填充了 ai 的房间
+func (q *Queue) NewRoomWithAi(team Team) Room {
+	return q.newRoomWithAi(team)
+}
+
+// GetMatchRange 获取匹配范围，mst1 和 mst2 为双方开始匹配的时间。
+// 按匹配时间短的一方已经等待的秒数选择 MatchRanges 中的阶段，等待时间短时使用前面更严格的阶段；
+// 早期版本直接用开始匹配的时间戳与 MaxMatchSec 比较，总是使用最后一个阶段
+func (q *Queue) GetMatchRange(mst1, mst2 int64) MatchRange {
+	// 以匹配时间短的那个为准
+	mt := time.Now().Unix() - int64(math.Max(float64(mst1), float64(mst2)))
+	stage := q.MatchRangeStage(mt)
+	if stage < 0 {
+		return defaultMatchRange
+	}
+	return q.MatchRanges[stage]
+}
+
+// matchStartSec 获取 groups 用于计算匹配范围的开始匹配时间，startSec 为实际开始匹配的时间，
+// groups 中有评分不确定的玩家时提前 UncertainWaitSec 秒，有连败的玩家时提前 LosingStreakWaitSec 秒
+func (q *Queue) matchStartSec(startSec int64, groups ...Group) int64 {
+	var bonus int64
+	for _, g := range groups {
+		for _, p := range g.Players() {
+			if p.IsAi() {
+				continue
+			}
+			if q.UncertainDR > 0 && q.UncertainWaitSec > bonus && p.GetArgs().DR >= q.UncertainDR {
+				bonus = q.UncertainWaitSec
+			}
+			if sp, ok := p.(StreakPlayer); ok && q.LosingStreak > 0 && q.LosingStreakWaitSec > bonus &&
+				-sp.GetStreak() >= q.LosingStreak {
+				bonus = q.LosingStreakWaitSec
 			}
 		}
 	}
+	return startSec - bonus
+}
 
-	// 没找着
-	return tmpTeam, false
+// teamMatchStartSec 获取阵营用于计算匹配范围的开始匹配时间
+func (q *Queue) teamMatchStartSec(t Team) int64 {
+	return q.matchStartSec(t.GetStartMatchTimeSec(), t.Groups()...)
 }
 
-// canGroupTogether 判断队伍之间是否可以组成一个阵营
-func (q *Queue) canGroupTogether(team Team, group Group) bool {
-	for _, g := range team.Groups() {
-		mr := q.getMatchRange(g.GetStartMatchTimeSec(), group.GetStartMatchTimeSec())
+// roomMatchStartSec 获取房间用于计算匹配范围的开始匹配时间
+func (q *Queue) roomMatchStartSec(r Room) int64 {
+	var groups []Group
+	for _, t := range r.Teams() {
+		groups = append(groups, t.Groups()...)
+	}
+	return q.matchStartSec(r.GetStartMatchTimeSec(), groups...)
+}
 
-		// 是否加入车队
-		if len(g.Players()) != q.TeamPlayerLimit && !mr.CanJoinTeam && len(group.Players()) == q.TeamPlayerLimit {
-			return false
+// MatchRangeStage 获取匹配了 matchSec 秒时所处的匹配范围下标，没有配置匹配范围时返回 -1
+func (q *Queue) MatchRangeStage(matchSec int64) int {
+	if len(q.MatchRanges) == 0 {
+		return -1
+	}
+	for i, mr := range q.MatchRanges {
+		if matchSec < mr.MaxMatchSec {
+			return i
 		}
+	}
 
-		// mmr 是否匹配
-		gMMR := g.MMR()
-		if mr.MMRGapPercent != 0 && math.Abs(gMMR-group.MMR()) > g.MMR()*float64(mr.MMRGapPercent)/100 {
-			return false
-		}
+	// 默认返回最后一个
+	return len(q.MatchRanges) - 1
+}
+
+// removeGroup 从排队列表、临时阵营和临时房间中移除队伍，不可以与 Match 并发调用
+func (q *Queue) removeGroup(groupID string) (Group, bool) {
+	q.Lock()
+	defer q.Unlock()
 
-		// 段位是否匹配
-		if mr.StarGap != 0 && int(math.Abs(float64(g.Star()-group.Star()))) > mr.StarGap {
-			return false
+	for i, g := range q.Groups {
+		if g.ID() == groupID {
+			q.Groups = append(q.Groups[:i], q.Groups[i+1:]...)
+			return g, true
 		}
 	}
-	return true
-}
 
-// canTeamTogether 判断阵营之间是否可以组成一个房间
-func (q *Queue) canTeamTogether(room Room, tt Team) bool {
-	// 判断 tt 是否满足跟当前 room 中的所有 team 匹配的条件
-	// 只要有一个不满足，就返回 false
-	for _, t := range room.Teams() {
-		mr := q.getMatchRange(t.GetStartMatchTimeSec(), tt.GetStartMatchTimeSec())
-		// 是否加入车队
-		if len(t.Groups()) > 1 && !mr.CanJoinTeam && len(tt.Groups()) == 1 {
-			return false
+	for i, t := range q.tmpTeam {
+		g, ok := findGroupInTeam(t, groupID)
+		if !ok {
+			continue
 		}
-
-		// mmr 是否匹配
-		tMMR := t.AverageMMR()
-		if mr.MMRGapPercent != 0 && math.Abs(tMMR-tt.AverageMMR()) > tMMR*float64(mr.MMRGapPercent)/100 {
-			return false
+		t.RemoveGroup(groupID)
+		if t.PlayerCount() == 0 {
+			q.tmpTeam = append(q.tmpTeam[:i], q.tmpTeam[i+1:]...)
 		}
+		return g, true
+	}
 
-		// 段位是否匹配
-		if mr.StarGap != 0 && int(math.Abs(float64(t.Star()-tt.Star()))) > mr.StarGap {
-			return false
+	for i, r := range q.tmpRoom {
+		for _, t := range r.Teams() {
+			g, ok := findGroupInTeam(t, groupID)
+			if !ok {
+				continue
+			}
+			// 阵营不满了，从房间中移出，放回临时阵营中重新补齐
+			t.RemoveGroup(groupID)
+			r.RemoveTeam(t)
+			if t.PlayerCount() != 0 {
+				q.tmpTeam = append(q.tmpTeam, t)
+			}
+			if len(r.Teams()) == 0 {
+				q.tmpRoom = append(q.tmpRoom[:i], q.tmpRoom[i+1:]...)
+			}
+			return g, true
 		}
 	}
-	return true
-}
 
-// getMatchRange 获取匹配范围
-func (q *Queue) getMatchRange(mst1, mst2 int64) MatchRange {
-	if len(q.MatchRanges) == 0 {
-		return defaultMatchRange
-	}
+	return nil, false
+}
 
-	// 以匹配时间短的那个为准
-	mt := int64(math.Min(float64(mst1), float64(mst2)))
-	for _, mr := range q.MatchRanges {
-		if mt < mr.MaxMatchSec {
-			return mr
+// findGroupInTeam 在阵营中查找队伍
+func findGroupInTeam(t Team, groupID string) (Group, bool) {
+	for _, g := range t.Groups() {
+		if g.ID() == groupID {
+			return g, true
 		}
 	}
+	return nil, false
+}
 
-	// 默认返回最后一个
-	return q.MatchRanges[len(q.MatchRanges)-1]
+// isEmpty 判断队列中是否已经没有队伍，不可以与 Match 并发调用
+func (q *Queue) isEmpty() bool {
+	q.Lock()
+	defer q.Unlock()
+
+	return len(q.Groups) == 0 && len(q.tmpTeam) == 0 && len(q.tmpRoom) == 0
 }
 
-// stopMatch 取消匹配
+// stopMatch 取消匹配，返回所有还在匹配中的队伍
 func (q *Queue) stopMatch() []Group {
 	q.Lock()
 	defer q.Unlock()
 
-	groups := q.clearTmp()
-	q.Groups = append(q.Groups, groups...)
+	q.Groups = append(q.Groups, q.clearTmp()...)
+	groups := make([]Group, 0, len(q.Groups))
 	for _, g := range q.Groups {
 		if g.GetState() != GroupStateQueuing {
 			continue
@@ -444,6 +477,7 @@ func (q *Queue) stopMatch() []Group {
 			}
 		}
 		g.SetState(GroupStateUnready)
+		groups = append(groups, g)
 	}
 	q.Groups = make([]Group, 0)
 	return groups
@@ -0,0 +1,212 @@
+package glicko2
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRatingPeriodStarted  = errors.New("rating period manager has already been started")
+	ErrInvalidFlushInterval = errors.New("flush interval must be positive")
+)
+
+// RatingPeriodArgs 计算周期参数，FlushInterval 和 MaxGamesPerPlayer 满足任意一个都会结束当前计算周期
+type RatingPeriodArgs struct {
+	FlushInterval     time.Duration // 每隔多久结束一次计算周期，需要调用 Start 才生效，0 表示不定时结束
+	MaxGamesPerPlayer int           // 有玩家在当前计算周期内的对局数达到该值时结束计算周期，0 表示不限制
+
+	OnFlush func(report *SettlementReport) // 计算周期结束、玩家参数更新后回调，为空或周期内没有对局时不回调
+}
+
+// RatingPeriodManager 将多局游戏收集到同一个 glicko-2 计算周期内，周期结束时才统一更新玩家的参数。
+// 周期结束前，每局游戏都会返回基于当前周期内所有对局计算出的临时结算结果，用于展示。
+type RatingPeriodManager struct {
+	sync.Mutex
+	settler *Settler
+	started bool
+	pending map[string]*pendingPlayer // 当前计算周期内有对局的玩家
+	order   []string                  // 玩家加入当前计算周期的顺序
+
+	RatingPeriodArgs
+}
+
+// pendingPlayer 是一个玩家在当前计算周期内的数据
+type pendingPlayer struct {
+	entry    *settleEntry // 玩家最近一局的结算数据
+	before   Args         // 计算周期开始前的参数
+	outcomes []outcome    // 计算周期内所有对局的结果
+	rooms    []int64      // 计算周期内参与的房间，没有 ID 的房间不记录
+	games    int          // 计算周期内的对局数
+}
+
+func NewRatingPeriodManager(settler *Settler, args RatingPeriodArgs) *RatingPeriodManager {
+	return &RatingPeriodManager{
+		settler:          settler,
+		pending:          make(map[string]*pendingPlayer),
+		RatingPeriodArgs: args,
+	}
+}
+
+// AddRoom 将一局游戏加入当前计算周期，返回房间中每个真人玩家的临时结算结果，此时玩家的参数不会更新。
+// 加入后有玩家的对局数达到 MaxGamesPerPlayer 时会立即结束计算周期。
+// Settler 配置了 Store 时与 Settler.UpdateMMR 一样，同一个房间只会加入一次，重复加入时返回之前的临时结算结果
+func (m *RatingPeriodManager) AddRoom(room Room) *SettlementReport {
+	var flushed *SettlementReport
+	report := m.settler.once(room, false, func(*SettlementReport) *SettlementReport {
+		var report *SettlementReport
+		report, flushed = m.addRoom(room)
+		return report
+	})
+
+	if flushed != nil && m.OnFlush != nil {
+		m.OnFlush(flushed)
+	}
+	return report
+}
+
+// addRoom 将一局游戏加入当前计算周期，返回临时结算结果和因此结束的计算周期的结算报告
+func (m *RatingPeriodManager) addRoom(room Room) (*SettlementReport, *SettlementReport) {
+	entries, report := m.settler.collect(room, nil)
+	report.Provisional = true
+
+	m.Lock()
+	defer m.Unlock()
+
+	flush := false
+	players := make([]Player, 0, len(entries))
+	for _, e := range entries {
+		players = append(players, e.player)
+		id := e.player.ID()
+		pp, ok := m.pending[id]
+		if !ok {
+			// 对手都是以赛前的参数计入的，玩家自身也以计算周期开始前的参数为准
+			pp = &pendingPlayer{before: e.before}
+			m.pending[id] = pp
+			m.order = append(m.order, id)
+		}
+		pp.entry = e
+		pp.outcomes = append(pp.outcomes, e.outcomes...)
+		pp.addRoom(room.GetID())
+		pp.games++
+		report.Players = append(report.Players, m.settler.settle(e, pp.before, pp.outcomes))
+		if m.MaxGamesPerPlayer > 0 && pp.games >= m.MaxGamesPerPlayer {
+			flush = true
+		}
+	}
+	// 定级对局数和连胜连败按局计算，不等计算周期结束
+	countPlacement(players)
+	saveStreaks(entries)
+	if flush {
+		return report, m.flush()
+	}
+	return report, nil
+}
+
+// addRoom 记录玩家参与的房间
+func (pp *pendingPlayer) addRoom(roomID int64) {
+	if roomID == 0 {
+		return
+	}
+	for _, id := range pp.rooms {
+		if id == roomID {
+			return
+		}
+	}
+	pp.rooms = append(pp.rooms, roomID)
+}
+
+// Provisional 获取玩家在当前计算周期内的临时结算结果，玩家在当前计算周期内没有对局时返回 false
+func (m *RatingPeriodManager) Provisional(playerID string) (PlayerSettlement, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	pp, ok := m.pending[playerID]
+	if !ok {
+		return PlayerSettlement{}, false
+	}
+	return m.settler.settle(pp.entry, pp.before, pp.outcomes), true
+}
+
+// Flush 立即结束当前计算周期，更新周期内所有玩家的参数并返回结算报告，报告的 RoomID 为 0。
+// 计算周期内玩家的参数有其他变化时，周期带来的变化加在玩家当前的参数上。
+// 写入日志的记录会带上玩家在周期内参与的房间，之后可以用 Settler.Rollback 撤销其中一局游戏
+func (m *RatingPeriodManager) Flush() *SettlementReport {
+	m.Lock()
+	report := m.flush()
+	m.Unlock()
+
+	if m.OnFlush != nil && len(report.Players) != 0 {
+		m.OnFlush(report)
+	}
+	return report
+}
+
+// flush 结束当前计算周期，需要持有锁
+func (m *RatingPeriodManager) flush() *SettlementReport {
+	report := &SettlementReport{
+		Players: make([]PlayerSettlement, 0, len(m.order)),
+	}
+	players := make([]Player, 0, len(m.order))
+	for _, id := range m.order {
+		pp := m.pending[id]
+		ps := m.settler.settle(pp.entry, pp.before, pp.outcomes)
+		if current := *pp.entry.player.GetArgs(); current != pp.before {
+			// 计算周期内玩家的参数有其他变化（如撤销、不活跃增长或其他房间的结算），把周期带来的变化加到当前参数上
+			ps.Before = current
+			ps.After = m.settler.shift(current, ps.Delta)
+			ps.Delta = Args{
+				MMR: ps.After.MMR - ps.Before.MMR,
+				DR:  ps.After.DR - ps.Before.DR,
+				V:   ps.After.V - ps.Before.V,
+			}
+		}
+		report.Players = append(report.Players, ps)
+		players = append(players, pp.entry.player)
+	}
+	applySettlement(report, players)
+
+	journal := make([]JournalEntry, 0, len(m.order))
+	for i, id := range m.order {
+		if ps := report.Players[i]; ps.Err == nil {
+			pp := m.pending[id]
+			entry := newJournalEntry(JournalKindSettle, 0, ps, pp.outcomes)
+			entry.Rooms = pp.rooms
+			journal = append(journal, entry)
+		}
+	}
+	m.settler.writeJournal(report, journal)
+
+	m.pending = make(map[string]*pendingPlayer)
+	m.order = nil
+	return report
+}
+
+// Start 异步启动定时结束计算周期，ctx 取消后停止，停止时不会结束当前计算周期，需要时可以再调用 Flush
+func (m *RatingPeriodManager) Start(ctx context.Context) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.FlushInterval <= 0 {
+		return ErrInvalidFlushInterval
+	}
+	if m.started {
+		return ErrRatingPeriodStarted
+	}
+	m.started = true
+
+	go func() {
+		ticker := time.NewTicker(m.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.Flush()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,86 @@
+package glicko2
+
+import (
+	"math"
+)
+
+// MatchResult 是一个房间的匹配结果
+type MatchResult struct {
+	Room      Room
+	QueueName string // 匹配成功的队列
+
+	GroupWaitSec map[string]int64 // 每个队伍的匹配时长，key 为队伍 ID
+
+	TeamMMRSpread   float64   // 非 ai 阵营之间平均 mmr 的极差
+	InTeamMMRSpread []float64 // 每个阵营内非 ai 玩家 mmr 的极差，顺序与 Room.Teams() 一致
+	StarSpread      int       // 非 ai 队伍之间段位的极差
+
+	MatchRangeStage int  // 匹配时所处的 MatchRange 下标，以匹配时间最短的队伍为准，-1 表示使用默认匹配范围
+	HasAi           bool // 是否填充了 ai
+}
+
+// newMatchResult 构建房间的匹配结果，now 为完成匹配的时间
+func (q *Queue) newMatchResult(room Room, now int64) MatchResult {
+	teams := room.Teams()
+	res := MatchResult{
+		Room:            room,
+		QueueName:       q.Name,
+		GroupWaitSec:    make(map[string]int64),
+		InTeamMMRSpread: make([]float64, len(teams)),
+		MatchRangeStage: -1,
+		HasAi:           room.HasAi(),
+	}
+
+	var (
+		lowestTeamMMR, highestTeamMMR = math.Inf(1), math.Inf(-1)
+		lowestStar, highestStar       = math.MaxInt, math.MinInt
+		latestStartSec                int64
+	)
+	for i, t := range teams {
+		if t.IsAi() {
+			continue
+		}
+		teamMMR := t.AverageMMR()
+		lowestTeamMMR = math.Min(lowestTeamMMR, teamMMR)
+		highestTeamMMR = math.Max(highestTeamMMR, teamMMR)
+
+		lowestMMR, highestMMR := math.Inf(1), math.Inf(-1)
+		for _, g := range t.Groups() {
+			mst := g.GetStartMatchTimeSec()
+			res.GroupWaitSec[g.ID()] = now - mst
+			if mst = q.matchStartSec(mst, g); mst > latestStartSec {
+				latestStartSec = mst
+			}
+
+			star := g.Star()
+			if star < lowestStar {
+				lowestStar = star
+			}
+			if star > highestStar {
+				highestStar = star
+			}
+
+			for _, p := range g.Players() {
+				if p.IsAi() {
+					continue
+				}
+				lowestMMR = math.Min(lowestMMR, MatchingMMR(p))
+				highestMMR = math.Max(highestMMR, MatchingMMR(p))
+			}
+		}
+		if highestMMR > lowestMMR {
+			res.InTeamMMRSpread[i] = highestMMR - lowestMMR
+		}
+	}
+
+	if highestTeamMMR > lowestTeamMMR {
+		res.TeamMMRSpread = highestTeamMMR - lowestTeamMMR
+	}
+	if highestStar > lowestStar {
+		res.StarSpread = highestStar - lowestStar
+	}
+	if latestStartSec != 0 {
+		res.MatchRangeStage = q.MatchRangeStage(now - latestStartSec)
+	}
+	return res
+}
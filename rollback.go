@@ -0,0 +1,289 @@
+package glicko2
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RollbackPolicy 撤销一局游戏的结算时，对之后又进行了对局的玩家的处理方式
+type RollbackPolicy uint8
+
+const (
+	// 从这局游戏开始，根据日志跳过这局游戏重新计算玩家之后的所有结算。
+	// 对手的参数仍使用当时的参数；日志之外的参数变化（如赛季重置）会被覆盖，这种情况应使用 RollbackPolicyInverseDelta
+	RollbackPolicyRecompute RollbackPolicy = iota
+	// 只在玩家当前的参数上减去这局游戏带来的变化，计算周期中的一局游戏带来的变化是去掉这局游戏前后周期结算结果的差
+	RollbackPolicyInverseDelta
+)
+
+var (
+	ErrNoJournal      = errors.New("settler has no journal")
+	ErrRoomNotSettled = errors.New("room has not been settled")
+	ErrRoomRolledBack = errors.New("room has already been rolled back")
+)
+
+// Rollback 根据结算日志撤销一局游戏（如作弊对局）对其中所有真人玩家参数的影响，players 为这些玩家当前的实例，
+// 日志中有记录但 players 中没有的玩家会记录在报告的错误中。撤销的结果也会写入日志，并在配置了 Store 时标记之前的结算报告。
+// 同一局游戏只能撤销一次，之后被强制重新结算（见 ForceUpdateMMR）时可以再次撤销。
+// 房间是在计算周期（见 RatingPeriodManager）中结算的时，去掉这局游戏的对局重新计算整个计算周期。
+func (s *Settler) Rollback(roomID int64, players []Player, policy RollbackPolicy) (*SettlementReport, error) {
+	if s.Journal == nil {
+		return nil, ErrNoJournal
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	roomEntries, err := s.Journal.RoomEntries(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("load journal for room %d: %w", roomID, err)
+	}
+	// 撤销之后又被强制重新结算时，只撤销之后的结算
+	settled := make(map[string]bool)
+	rolledBack := false
+	for _, e := range roomEntries {
+		switch e.Kind {
+		case JournalKindRollback:
+			settled = make(map[string]bool)
+			rolledBack = true
+		case JournalKindSettle:
+			settled[e.PlayerID] = true
+			rolledBack = false
+		}
+	}
+	if rolledBack {
+		return nil, fmt.Errorf("%w: %d", ErrRoomRolledBack, roomID)
+	}
+	if roomID == 0 || len(settled) == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrRoomNotSettled, roomID)
+	}
+
+	playerMap := make(map[string]Player, len(players))
+	for _, p := range players {
+		playerMap[p.ID()] = p
+	}
+
+	report := &SettlementReport{RoomID: roomID}
+	var journal []JournalEntry
+	for _, e := range roomEntries {
+		// 同一局游戏被强制重新结算过时，每个玩家只撤销一次
+		if !settled[e.PlayerID] {
+			continue
+		}
+		settled[e.PlayerID] = false
+
+		ps := PlayerSettlement{PlayerID: e.PlayerID}
+		p, ok := playerMap[e.PlayerID]
+		if !ok {
+			ps.Err = fmt.Errorf("player %s of room %d is not provided", e.PlayerID, roomID)
+			report.Errors = append(report.Errors, ps.Err)
+			report.Players = append(report.Players, ps)
+			continue
+		}
+
+		ps.Before = *p.GetArgs()
+		entries, err := s.Journal.PlayerEntries(e.PlayerID)
+		if err != nil {
+			ps.Err = fmt.Errorf("load journal for player %s: %w", e.PlayerID, err)
+			report.Errors = append(report.Errors, ps.Err)
+			report.Players = append(report.Players, ps)
+			continue
+		}
+		switch policy {
+		case RollbackPolicyInverseDelta:
+			ps.After = s.inverseDelta(ps.Before, entries, roomID)
+		default:
+			ps.After = s.recompute(ps.Before, entries, roomID)
+		}
+		ps.Delta = Args{
+			MMR: ps.After.MMR - ps.Before.MMR,
+			DR:  ps.After.DR - ps.Before.DR,
+			V:   ps.After.V - ps.Before.V,
+		}
+
+		if err := p.SetArgs(&ps.After); err != nil {
+			ps.Err = fmt.Errorf("set args for player %s: %w", ps.PlayerID, err)
+			report.Errors = append(report.Errors, ps.Err)
+		} else {
+			journal = append(journal, newJournalEntry(JournalKindRollback, roomID, ps, nil))
+		}
+		report.Players = append(report.Players, ps)
+	}
+	s.writeJournal(report, journal)
+	if s.Store != nil {
+		s.markRolledBack(report)
+	}
+	return report, nil
+}
+
+// markRolledBack 将 Store 中房间的结算报告标记为已撤销，之后强制重新结算时不会再撤销一次之前的结算
+func (s *Settler) markRolledBack(report *SettlementReport) {
+	earlier, err := s.Store.Load(report.RoomID)
+	if err == nil && earlier != nil {
+		earlier.RolledBack = true
+		err = s.Store.Save(earlier)
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("mark settlement for room %d as rolled back: %w", report.RoomID, err))
+	}
+}
+
+// inverseDelta 在 current 上减去玩家在这局游戏中的结算带来的变化，entries 为玩家按写入顺序的所有记录。
+// 强制重新结算（见 ForceUpdateMMR）时之前的结算已经撤销，所以只减去最后一次结算的变化
+func (s *Settler) inverseDelta(current Args, entries []JournalEntry, roomID int64) Args {
+	voided := voidedRooms(entries)
+	var last *JournalEntry
+	for i, e := range entries {
+		if e.settles(roomID) {
+			last = &entries[i]
+		}
+	}
+	switch {
+	case last == nil:
+		return current
+	case last.RoomID == roomID:
+		return s.revert(current, Args{
+			MMR: last.After.MMR - last.Before.MMR,
+			DR:  last.After.DR - last.Before.DR,
+			V:   last.After.V - last.Before.V,
+		})
+	}
+
+	// 计算周期的结算：减去去掉这局游戏前后周期结算结果的差，周期内更早撤销的房间已经减去
+	with := s.rerate(last.Before, *last, voided)
+	voided[roomID] = true
+	without := s.rerate(last.Before, *last, voided)
+	return s.revert(current, Args{
+		MMR: with.MMR - without.MMR,
+		DR:  with.DR - without.DR,
+		V:   with.V - without.V,
+	})
+}
+
+// revert 在 current 上减去 delta
+func (s *Settler) revert(current, delta Args) Args {
+	return s.shift(current, Args{MMR: -delta.MMR, DR: -delta.DR, V: -delta.V})
+}
+
+// shift 在 current 上加上 delta
+func (s *Settler) shift(current, delta Args) Args {
+	rs := s.system()
+	res := Args{
+		MMR: current.MMR + delta.MMR,
+		DR:  rs.clampDR(current.DR + delta.DR),
+		V:   current.V + delta.V,
+	}
+	return rs.normalize(res)
+}
+
+// recompute 从玩家在 roomID 中的第一次结算开始，跳过已经撤销的房间重新计算玩家之后的参数，
+// entries 为玩家按写入顺序的所有记录，日志中没有玩家在 roomID 中的结算时返回 current
+func (s *Settler) recompute(current Args, entries []JournalEntry, roomID int64) Args {
+	// 已经撤销的房间，包括这次要撤销的
+	voided := voidedRooms(entries)
+	voided[roomID] = true
+	// 每个房间最后一次结算的记录下标，更早的结算已经被强制重新结算撤销
+	latest := make(map[int64]int)
+	for i, e := range entries {
+		if e.Kind == JournalKindSettle && e.RoomID != 0 {
+			latest[e.RoomID] = i
+		}
+	}
+
+	start := -1
+	settledBefore := make(map[int64]bool)   // 在这局游戏之前结算的房间
+	applied := make(map[int64]JournalEntry) // 在这局游戏之前结算的房间最后一次结算的记录
+	for i, e := range entries {
+		if e.settles(roomID) {
+			start = i
+			break
+		}
+		if e.Kind == JournalKindRollback {
+			// 撤销后 res 中已经不包含这个房间之前的结算
+			delete(applied, e.RoomID)
+		}
+		if e.Kind != JournalKindSettle {
+			continue
+		}
+		settledBefore[e.RoomID] = true
+		applied[e.RoomID] = e
+		for _, id := range e.Rooms {
+			settledBefore[id] = true
+		}
+	}
+	if start < 0 {
+		return current
+	}
+
+	res := entries[start].Before
+	for i, e := range entries[start:] {
+		switch {
+		case e.Kind == JournalKindRollback:
+			// 之后才撤销的更早的房间，其影响已经包含在 res 中，需要同样撤销；更晚的房间在下面直接跳过
+			if settledBefore[e.RoomID] {
+				res = addDelta(res, e)
+			}
+		case e.Kind != JournalKindSettle:
+			res = addDelta(res, e)
+		case e.RoomID != 0 && (voided[e.RoomID] || latest[e.RoomID] != start+i):
+		case e.RoomID != 0 && settledBefore[e.RoomID]:
+			// 更早的房间被强制重新结算，res 中之前的结算换成这次的结算
+			if prev, ok := applied[e.RoomID]; ok {
+				res = addArgs(res, Args{
+					MMR: prev.Before.MMR - prev.After.MMR,
+					DR:  prev.Before.DR - prev.After.DR,
+					V:   prev.Before.V - prev.After.V,
+				})
+			}
+			res = addDelta(res, e)
+		case len(e.Outcomes) != 0 || len(e.Rooms) != 0:
+			res = s.rerate(res, e, voided)
+		default:
+			res = addDelta(res, e)
+		}
+	}
+	return res
+}
+
+// rerate 跳过已经撤销的房间中的对局，以 before 为基础重新计算日志记录中的结算
+func (s *Settler) rerate(before Args, e JournalEntry, voided map[int64]bool) Args {
+	outcomes := make([]outcome, 0, len(e.Outcomes))
+	for _, o := range e.outcomes() {
+		if !voided[o.room] {
+			outcomes = append(outcomes, o)
+		}
+	}
+	return addArgs(s.rate(before, outcomes, e.Placement), e.Adjustment)
+}
+
+// voidedRooms 获取玩家的记录中已经撤销的房间，撤销后又被强制重新结算的房间不算
+func voidedRooms(entries []JournalEntry) map[int64]bool {
+	res := make(map[int64]bool)
+	for _, e := range entries {
+		switch {
+		case e.Kind == JournalKindRollback:
+			res[e.RoomID] = true
+		case e.Kind == JournalKindSettle && e.RoomID != 0:
+			delete(res, e.RoomID)
+		}
+	}
+	return res
+}
+
+// addDelta 在 a 上加上日志记录带来的变化
+func addDelta(a Args, e JournalEntry) Args {
+	return Args{
+		MMR: a.MMR + e.After.MMR - e.Before.MMR,
+		DR:  a.DR + e.After.DR - e.Before.DR,
+		V:   a.V + e.After.V - e.Before.V,
+	}
+}
+
+// addArgs 将两组参数相加
+func addArgs(a, b Args) Args {
+	return Args{
+		MMR: a.MMR + b.MMR,
+		DR:  a.DR + b.DR,
+		V:   a.V + b.V,
+	}
+}
@@ -0,0 +1,98 @@
+package glicko2
+
+// Router 决定队伍开始匹配时进入哪个队列，以及匹配不成功时什么时候移动到哪个队列
+type Router interface {
+
+	// Route 返回队伍开始匹配时进入的队列名称
+	Route(g Group) string
+
+	// Promote 判断在 from 队列中本轮没有匹配成功的队伍是否需要移动到别的队列，
+	// waitSec 为队伍已经匹配的时长，返回目标队列名称
+	Promote(from string, g Group, waitSec int64) (string, bool)
+}
+
+// RouteRule 路由规则，队伍满足 Match 时进入 Queue 队列
+type RouteRule struct {
+	Queue string
+	Match func(g Group) bool // 为空时匹配所有队伍
+}
+
+// PromoteRule 移动规则，满足 Match 的队伍在 From 队列中匹配了 WaitTimeSec 后移动到 To 队列
+type PromoteRule struct {
+	From        string
+	To          string
+	WaitTimeSec int64
+	Match       func(g Group) bool // 为空时匹配所有队伍
+}
+
+// RoutingPolicy 是基于规则的 Router，按顺序使用第一条满足条件的规则
+type RoutingPolicy struct {
+	Routes     []RouteRule
+	Promotions []PromoteRule
+}
+
+func (rp RoutingPolicy) Route(g Group) string {
+	for _, r := range rp.Routes {
+		if r.Match == nil || r.Match(g) {
+			return r.Queue
+		}
+	}
+	return ""
+}
+
+func (rp RoutingPolicy) Promote(from string, g Group, waitSec int64) (string, bool) {
+	for _, p := range rp.Promotions {
+		if p.From != from || waitSec < p.WaitTimeSec {
+			continue
+		}
+		if p.Match == nil || p.Match(g) {
+			return p.To, true
+		}
+	}
+	return "", false
+}
+
+// NewDefaultRouting 默认的路由策略：
+// 非车队进入 NormalQueue，车队进入 TeamQueue，
+// 车队在 TeamQueue 中按车队类型匹配了对应的时长后移动到 NormalQueue。
+func NewDefaultRouting(args QueueArgs) RoutingPolicy {
+	return RoutingPolicy{
+		Routes: []RouteRule{
+			{Queue: NormalQueue, Match: GroupTypeIs(GroupTypeNotTeam)},
+			{Queue: TeamQueue},
+		},
+		Promotions: []PromoteRule{
+			{
+				From:        TeamQueue,
+				To:          NormalQueue,
+				WaitTimeSec: args.MaliciousTeamWaitTimeSec,
+				Match:       GroupTypeIs(GroupTypeMaliciousTeam),
+			},
+			{
+				From:        TeamQueue,
+				To:          NormalQueue,
+				WaitTimeSec: args.UnfriendlyTeamWaitTimeSec,
+				Match:       GroupTypeIs(GroupTypeUnfriendlyTeam),
+			},
+			{
+				From:        TeamQueue,
+				To:          NormalQueue,
+				WaitTimeSec: args.NormalTeamWaitTimeSec,
+				Match:       GroupTypeIs(GroupTypeNormalTeam),
+			},
+		},
+	}
+}
+
+// GroupTypeIs 判断队伍是否是其中一种车队类型
+func GroupTypeIs(types ...GroupType) func(g Group) bool {
+	return func(g Group) bool {
+		gt := g.Type()
+		for _, t := range types {
+			if gt == t {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,232 @@
+package glicko2
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	defaultSeasonMMRRatio     = 0.7
+	defaultSeasonMinMMR       = 1000
+	defaultSeasonMaxMMR       = 7500
+	defaultSeasonDRPerStarGap = 10
+	defaultSeasonMaxDR        = 700
+	defaultSeasonV            = 0.06
+	defaultMMRBucketWidth     = 500
+)
+
+// SeasonRecord 是一个玩家的赛季数据
+type SeasonRecord struct {
+	PlayerID string
+	Args     Args
+	Star     int // 当前星数
+	BestStar int // 历史最高星数
+
+	PlacementGames int     // 新赛季需要完成的定级对局数，由 SeasonReset 设置，0 表示不需要定级
+	PlacementMMR   float64 // 定级期间匹配使用的 mmr，为上赛季的 mmr，不需要定级时为 0
+}
+
+// StartPlacement 为实现了 PlacementPlayer 的玩家开始新赛季的定级，PlayerStore.Save 可以在更新玩家数据时调用
+func (rec SeasonRecord) StartPlacement(p Player) {
+	if pp, ok := p.(PlacementPlayer); ok && rec.PlacementGames > 0 {
+		pp.StartPlacement(rec.PlacementGames, rec.PlacementMMR)
+	}
+}
+
+// SeasonReset 按规则重置玩家的评分和星数，进入新赛季
+type SeasonReset struct {
+	SeasonResetArgs
+}
+
+// SeasonResetArgs 赛季重置规则，字段为 0 时使用括号中的默认值
+type SeasonResetArgs struct {
+	MMRRatio float64 // 新赛季的 mmr 为上赛季的比例 (0.7)
+	MinMMR   float64 // 新赛季 mmr 的下限 (1000)
+	MaxMMR   float64 // 新赛季 mmr 的上限 (7500)
+
+	// 新赛季的评分偏差为 MinDR + 当前星数与历史最高星数的差距 * DRPerStarGap，并限制在 [MinDR, MaxDR] 内
+	DRPerStarGap float64 // (10)
+	MinDR        float64 // (0)
+	MaxDR        float64 // (700)
+
+	V float64 // 新赛季的波动率 (0.06)
+
+	StarRatio float64 // 新赛季的星数为上赛季的比例，向下取整，0 表示清零
+
+	PlacementGames int // 新赛季需要完成的定级对局数（如 5），定级期间按上赛季的 mmr 匹配，0 表示不需要定级
+
+	MMRBucketWidth float64 // 分布报告中 mmr 的分段宽度 (500)
+}
+
+func NewSeasonReset(args SeasonResetArgs) *SeasonReset {
+	if args.MMRRatio <= 0 {
+		args.MMRRatio = defaultSeasonMMRRatio
+	}
+	if args.MinMMR <= 0 {
+		args.MinMMR = defaultSeasonMinMMR
+	}
+	if args.MaxMMR <= 0 {
+		args.MaxMMR = defaultSeasonMaxMMR
+	}
+	if args.DRPerStarGap <= 0 {
+		args.DRPerStarGap = defaultSeasonDRPerStarGap
+	}
+	if args.MaxDR <= 0 {
+		args.MaxDR = defaultSeasonMaxDR
+	}
+	if args.V <= 0 {
+		args.V = defaultSeasonV
+	}
+	if args.MMRBucketWidth <= 0 {
+		args.MMRBucketWidth = defaultMMRBucketWidth
+	}
+	return &SeasonReset{
+		SeasonResetArgs: args,
+	}
+}
+
+// Reset 计算一个玩家新赛季的数据，历史最高星数会更新为包含上赛季在内的最高值
+func (r *SeasonReset) Reset(rec SeasonRecord) SeasonRecord {
+	bestStar := rec.BestStar
+	if rec.Star > bestStar {
+		bestStar = rec.Star
+	}
+	gap := float64(bestStar - rec.Star)
+
+	res := SeasonRecord{
+		PlayerID: rec.PlayerID,
+		Args: Args{
+			MMR: math.Max(r.MinMMR, math.Min(rec.Args.MMR*r.MMRRatio, r.MaxMMR)),
+			DR:  math.Max(r.MinDR, math.Min(r.MinDR+gap*r.DRPerStarGap, r.MaxDR)),
+			V:   r.V,
+		},
+		Star:     int(math.Floor(float64(rec.Star) * math.Max(r.StarRatio, 0))),
+		BestStar: bestStar,
+	}
+	if r.PlacementGames > 0 {
+		res.PlacementGames = r.PlacementGames
+		res.PlacementMMR = rec.Args.MMR
+	}
+	return res
+}
+
+// PlayerStore 是赛季重置时读写玩家赛季数据的存储
+type PlayerStore interface {
+
+	// Range 遍历所有玩家的赛季数据，fn 返回错误时停止遍历并返回该错误
+	Range(fn func(rec SeasonRecord) error) error
+
+	// Save 保存玩家新赛季的数据，SeasonReset.Run 只在 Range 返回后调用。
+	// rec.PlacementGames 大于 0 时需要同时开始玩家的定级，见 SeasonRecord.StartPlacement
+	Save(rec SeasonRecord) error
+}
+
+// SeasonReport 是一次赛季重置的报告
+type SeasonReport struct {
+	DryRun bool
+	Before Distribution // 重置前的分布
+	After  Distribution // 重置后的分布
+	Errors []error      // 保存玩家数据时的错误
+}
+
+// Distribution 是一批玩家赛季数据的分布
+type Distribution struct {
+	Players    int
+	MMR        Summary
+	DR         Summary
+	V          Summary
+	Star       Summary
+	MMRBuckets []Bucket // 按 mmr 分段的玩家数，按 Min 升序排列，只包含有玩家的分段
+}
+
+// Summary 是一个数值的统计信息
+type Summary struct {
+	Min  float64
+	Max  float64
+	Mean float64
+}
+
+// Bucket 是 [Min, Max) 分段内的玩家数
+type Bucket struct {
+	Min   float64
+	Max   float64
+	Count int
+}
+
+// Run 对 store 中的所有玩家进行赛季重置，dryRun 为 true 时只统计分布，不保存。
+// 遍历结束后才开始保存，所以 Range 可以在遍历期间持有读锁、游标或事务；遍历失败时不保存任何玩家并返回错误。
+// 保存失败的玩家记录在报告中并继续处理其他玩家
+func (r *SeasonReset) Run(store PlayerStore, dryRun bool) (*SeasonReport, error) {
+	report := &SeasonReport{DryRun: dryRun}
+	before := newDistributionBuilder(r.MMRBucketWidth)
+	after := newDistributionBuilder(r.MMRBucketWidth)
+
+	var resets []SeasonRecord
+	err := store.Range(func(rec SeasonRecord) error {
+		res := r.Reset(rec)
+		before.add(rec)
+		after.add(res)
+		if !dryRun {
+			resets = append(resets, res)
+		}
+		return nil
+	})
+	report.Before = before.build()
+	report.After = after.build()
+	if err != nil {
+		return report, fmt.Errorf("range player store: %w", err)
+	}
+
+	for _, res := range resets {
+		if err := store.Save(res); err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("save season record for player %s: %w", res.PlayerID, err))
+		}
+	}
+	return report, nil
+}
+
+// distributionBuilder 逐个统计玩家的赛季数据
+type distributionBuilder struct {
+	bucketWidth float64
+	res         Distribution
+	buckets     map[float64]int
+}
+
+func newDistributionBuilder(bucketWidth float64) *distributionBuilder {
+	return &distributionBuilder{
+		bucketWidth: bucketWidth,
+		buckets:     make(map[float64]int),
+	}
+}
+
+func (b *distributionBuilder) add(rec SeasonRecord) {
+	b.res.Players++
+	b.res.MMR.add(rec.Args.MMR, b.res.Players)
+	b.res.DR.add(rec.Args.DR, b.res.Players)
+	b.res.V.add(rec.Args.V, b.res.Players)
+	b.res.Star.add(float64(rec.Star), b.res.Players)
+	b.buckets[math.Floor(rec.Args.MMR/b.bucketWidth)*b.bucketWidth]++
+}
+
+func (b *distributionBuilder) build() Distribution {
+	res := b.res
+	for low, count := range b.buckets {
+		res.MMRBuckets = append(res.MMRBuckets, Bucket{Min: low, Max: low + b.bucketWidth, Count: count})
+	}
+	sort.Slice(res.MMRBuckets, func(i, j int) bool {
+		return res.MMRBuckets[i].Min < res.MMRBuckets[j].Min
+	})
+	return res
+}
+
+// add 加入第 n 个值
+func (s *Summary) add(v float64, n int) {
+	if n == 1 {
+		*s = Summary{Min: v, Max: v, Mean: v}
+		return
+	}
+	s.Min = math.Min(s.Min, v)
+	s.Max = math.Max(s.Max, v)
+	s.Mean += (v - s.Mean) / float64(n)
+}
@@ -2,41 +2,462 @@ package glicko2
 
 import (
 	"fmt"
+	"math"
+	"sync"
+	"time"
 
 	glicko "github.com/zelenin/go-glicko2"
 )
 
+// SettleMode 结算模式
+type SettleMode uint8
+
+const (
+	// 每个玩家与其他阵营的每个真人玩家、阵营内的每个队友两两对局
+	SettleModePairwise SettleMode = iota
+	// 每个阵营由阵营内的真人玩家合成一个对手，玩家只与其他阵营的合成对手对局
+	SettleModeTeamComposite
+)
+
 // Settler 游戏结算器
-type Settler struct{}
+type Settler struct {
+	mu sync.Mutex // 配置了 Store 时持有，保证同一个房间不会被并发结算两次
+	SettlerArgs
+}
+
+// SettlerArgs 结算参数
+type SettlerArgs struct {
+	Mode   SettleMode   // 结算模式，默认为 SettleModePairwise
+	System RatingSystem // glicko-2 的系统常量和评分尺度，零值字段使用默认值
+
+	// 个人表现分在阵营间对局结果中的权重(0~1)，0 表示只看阵营胜负，1 表示只看个人表现。
+	// 阵营内的对局只要双方都有表现分（见 PerformancePlayer），就按表现分占比计算，否则按排名计算。
+	PerformanceWeight float64
+
+	// ai 难度等级（见 Player.AiLevel）对应的固定参数，配置了的 ai 会按该强度作为对手计入结算，但 ai 自身的参数不会更新；
+	// 没有配置的 ai 不参与结算
+	AiRatings map[int64]Args
+	// 每个玩家每局计入的 ai 对手数上限，0 表示不限制。ai 对手超过上限时，所有 ai 对手的权重按 上限/ai 对手数 等比例降低，
+	// 与 ai 对手的排名先后无关
+	MaxAiOpponents int
+
+	// 阵营中有玩家中途退出或挂机（见 ParticipationPlayer）时，其完整参与了对局的队友输掉的对局的权重降低的比例(0~1)，
+	// 1 表示队友不会因为输掉对局而掉分。中途退出或挂机的玩家自身对所有对手都记为失败
+	LeaverTeammateLossReduction float64
+
+	// 定级期间（见 PlacementPlayer）mmr 变化的放大倍数，不大于 1 时不放大
+	PlacementStepScale float64
+
+	Streak StreakArgs // 连胜连败调整参数
+
+	// 结算日志，配置后每个参数有变化的玩家都会写入一条记录，可以通过 Rollback 撤销一局游戏的结算。为空时不记录
+	Journal SettlementJournal
 
-func (s *Settler) UpdateMMR(room Room) {
+	// 已经结算过的房间的存储，配置后同一个房间（Room.GetID）只会结算一次，重复结算时返回之前的结算报告。
+	// ID 为 0 的房间不会保存。为空时不检查
+	Store SettlementStore
 
-	// 开启一个 glicko-2 计算周期
-	period := glicko.NewRatingPeriod()
+	// 不活跃玩家的评分偏差每经过一个 InactivityPeriod 按波动率增长一次，最多增长到 MaxInactivityDR，见 ApplyInactivity。
+	// InactivityPeriod 为 0 时不增长，MaxInactivityDR 为 0 时默认为 System.MaxDR，System.MaxDR 也为 0 时默认为 System.DefaultDR
+	InactivityPeriod time.Duration
+	MaxInactivityDR  float64
+}
+
+func NewSettler(args SettlerArgs) *Settler {
+	return &Settler{
+		SettlerArgs: args,
+	}
+}
+
+// system 获取填充了默认值的评分系统
+func (s *Settler) system() RatingSystem {
+	return s.System.withDefaults()
+}
+
+// SettlementReport 是一局游戏的结算报告
+type SettlementReport struct {
+	RoomID      int64              // 不是一局游戏的结算时为 0
+	Duplicate   bool               // 房间已经结算过，报告是之前的结算结果，这次没有更新玩家参数
+	Provisional bool               // 是加入计算周期时的临时结算结果（见 RatingPeriodManager），没有更新玩家参数
+	RolledBack  bool               // 房间的结算已经被 Rollback 撤销
+	Players     []PlayerSettlement // 参与结算的真人玩家，按阵营排名和阵营内排名排序
+	SkippedAi   []string           // 不更新参数的 ai 玩家 ID
+	Errors      []error            // 更新玩家参数时的错误
+}
+
+// PlayerSettlement 是一个玩家的结算结果
+type PlayerSettlement struct {
+	PlayerID      string
+	Placement     bool          // 结算时是否在定级期间
+	Streak        int           // 这局之后的连胜（正数）或连败（负数）局数，玩家没有实现 StreakPlayer 时为 0
+	Participation Participation // 玩家的参与状态
+	TeamRank      int           // 阵营在房间内的排名
+	Rank          int           // 玩家在阵营内的排名
+	Before        Args          // 结算前的参数
+	After         Args          // 结算后的参数
+	Delta         Args          // After - Before
+	Opponents     int           // 计入结算的对手数
+	AiOpponents   int           // 计入结算的 ai 对手数，超过 MaxAiOpponents 时权重按比例降低
+	Adjustment    Args          // After 中因为连胜连败额外调整的部分
+	Err           error         // 更新参数时的错误
+}
+
+// outcome 是玩家在一局中对一个对手的结果
+type outcome struct {
+	room     int64 // 对局所在的房间
+	opponent Args
+	score    glicko.MatchResult
+	weight   float64 // 对局在计算中的权重(0~1)
+	ai       bool    // 对手是否是 ai
+}
+
+// settleEntry 是一个玩家在结算过程中的数据
+type settleEntry struct {
+	player      Player
+	teamRank    int
+	before      Args
+	outcomes    []outcome
+	ai          bool // 是否是按固定参数计入结算的 ai
+	aiOpponents int
+
+	performance    float64
+	hasPerformance bool
+
+	placement      bool // 是否在定级期间
+	participation  Participation
+	share          float64           // 参与对局的比例，只对 ParticipationLate 生效
+	leaverTeammate bool              // 阵营中是否有其他玩家中途退出或挂机
+	streak         int               // 这局之后的连胜连败局数
+	earlier        *PlayerSettlement // 重新结算时之前的结算结果，已经从玩家参数中撤销
+}
+
+// abandoned 玩家是否中途退出或挂机
+func (e *settleEntry) abandoned() bool {
+	return e.participation == ParticipationLeft || e.participation == ParticipationAfk
+}
+
+// composite 是由阵营中参与结算的玩家合成的对手
+type composite struct {
+	args           Args
+	ai             bool    // 是否全部由 ai 合成
+	abandoned      float64 // 阵营中中途退出或挂机的玩家的比例，对手对这部分记为获胜
+	performance    float64
+	hasPerformance bool
+}
+
+// against 对手与合成对手的对局结果，阵营中中途退出或挂机的玩家按比例记为对手获胜，与 addMatch 一致
+func (c *composite) against(result glicko.MatchResult) glicko.MatchResult {
+	return glicko.MatchResult(c.abandoned*float64(glicko.MATCH_RESULT_WIN) + (1-c.abandoned)*float64(result))
+}
+
+// UpdateMMR 根据阵营和玩家的排名，按照结算模式更新房间中所有真人玩家的 glicko-2 参数，并返回结算报告。
+// 配置了 Store 时，已经结算过的房间不会再次结算，直接返回之前的结算报告
+func (s *Settler) UpdateMMR(room Room) *SettlementReport {
+	return s.updateMMR(room, false)
+}
+
+// ForceUpdateMMR 与 UpdateMMR 相同，但即使房间已经结算过也会再次结算，并覆盖 Store 中之前的结算报告，用于人工重新结算（如修正排名）。
+// 重新结算前会先撤销 Store 中之前的结算报告里已经更新到玩家上的变化，所以这局游戏只会计入一次；已经被 Rollback 撤销的房间直接结算。
+// 加入过计算周期的房间不能重新结算
+func (s *Settler) ForceUpdateMMR(room Room) *SettlementReport {
+	return s.updateMMR(room, true)
+}
+
+func (s *Settler) updateMMR(room Room, force bool) *SettlementReport {
+	return s.once(room, force, func(earlier *SettlementReport) *SettlementReport {
+		return s.settleRoom(room, earlier)
+	})
+}
+
+// once 配置了 Store 时保证同一个房间只通过 settle 结算一次，已经结算过时返回之前的结算报告。
+// force 为 true 时总是结算，并把之前的结算报告传给 settle
+func (s *Settler) once(room Room, force bool, settle func(earlier *SettlementReport) *SettlementReport) *SettlementReport {
+	roomID := room.GetID()
+	if s.Store == nil || roomID == 0 {
+		return settle(nil)
+	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	earlier, err := s.Store.Load(roomID)
+	if err != nil {
+		// 无法确认是否结算过时不结算，避免重复更新玩家参数
+		return &SettlementReport{
+			RoomID: roomID,
+			Errors: []error{fmt.Errorf("load settlement for room %d: %w", roomID, err)},
+		}
+	}
+	switch {
+	case earlier == nil:
+	case !force:
+		res := *earlier
+		res.Duplicate = true
+		return &res
+	case earlier.Provisional:
+		// 房间的对局已经计入了计算周期，无法单独撤销
+		return &SettlementReport{
+			RoomID: roomID,
+			Errors: []error{fmt.Errorf("%w: %d", ErrRoomInRatingPeriod, roomID)},
+		}
+	case earlier.RolledBack:
+		// 之前的结算已经撤销，不需要再撤销一次
+		earlier = nil
+	}
+
+	report := settle(earlier)
+	if err := s.Store.Save(report); err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("save settlement for room %d: %w", roomID, err))
+	}
+	return report
+}
+
+// settleRoom 结算房间并更新玩家的参数，earlier 为房间之前的结算报告，见 collect
+func (s *Settler) settleRoom(room Room, earlier *SettlementReport) *SettlementReport {
+	entries, report := s.collect(room, earlier)
+
+	// 先全部计算完再更新，保证每个玩家都是以对手的赛前参数计算的
+	players := make([]Player, 0, len(entries))
+	placements := make([]Player, 0, len(entries))
+	for _, e := range entries {
+		report.Players = append(report.Players, s.settle(e, e.before, e.outcomes))
+		players = append(players, e.player)
+		if e.earlier == nil {
+			placements = append(placements, e.player)
+		}
+	}
+	applySettlement(report, players)
+	countPlacement(placements)
+	saveStreaks(entries)
+
+	journal := make([]JournalEntry, 0, len(entries))
+	for i, e := range entries {
+		if ps := report.Players[i]; ps.Err == nil {
+			journal = append(journal, newJournalEntry(JournalKindSettle, report.RoomID, ps, e.outcomes))
+		}
+	}
+	s.writeJournal(report, journal)
+	return report
+}
+
+// collect 收集房间中每个真人玩家的对局结果，返回真人玩家的结算数据和只包含房间信息的结算报告。
+// earlier 不为空时是房间之前的结算报告，其中结算成功的玩家以撤销了之前这局的变化后的参数作为赛前参数
+func (s *Settler) collect(room Room, earlier *SettlementReport) ([]*settleEntry, *SettlementReport) {
+	report := &SettlementReport{
+		RoomID: room.GetID(),
+	}
+	prior := make(map[string]PlayerSettlement)
+	if earlier != nil {
+		for _, ps := range earlier.Players {
+			if ps.Err == nil {
+				prior[ps.PlayerID] = ps
+			}
+		}
+	}
+
+	// 记录所有真人玩家赛前的参数和计入结算的 ai 的固定参数，所有对局都以赛前参数计算
+	teams := room.SortTeamByRank()
+	entries := make([][]*settleEntry, len(teams))
+	for i, team := range teams {
+		for _, p := range team.SortPlayerByRank() {
+			e := &settleEntry{
+				player:   p,
+				teamRank: team.Rank(),
+			}
+			if p.IsAi() {
+				report.SkippedAi = append(report.SkippedAi, p.ID())
+				args, ok := s.AiRatings[p.AiLevel()]
+				if !ok {
+					continue
+				}
+				e.before, e.ai = args, true
+			} else {
+				e.before = *p.GetArgs()
+			}
+			if pp, ok := p.(PerformancePlayer); ok {
+				e.performance, e.hasPerformance = pp.Performance()
+			}
+			e.placement = InPlacement(p)
+			if ps, ok := prior[p.ID()]; ok && !p.IsAi() {
+				// 之前的结算已经计入了定级对局数，定级状态也以当时为准
+				e.before = s.revert(e.before, ps.Delta)
+				e.placement = ps.Placement
+				e.earlier = &ps
+			}
+			if pp, ok := p.(ParticipationPlayer); ok && !p.IsAi() {
+				e.participation, e.share = pp.Participation()
+			}
+			entries[i] = append(entries[i], e)
+		}
+
+		// 标记中途退出或挂机的玩家的队友
+		for _, e := range entries[i] {
+			if !e.abandoned() {
+				continue
+			}
+			for _, mate := range entries[i] {
+				if mate != e {
+					mate.leaverTeammate = true
+				}
+			}
+		}
+	}
+
+	switch s.Mode {
+	case SettleModeTeamComposite:
+		s.addCompositeMatches(teams, entries)
+	default:
+		s.addPairwiseMatches(teams, entries)
+	}
+
+	humans := make([]*settleEntry, 0, room.PlayerCount())
+	for _, teamEntries := range entries {
+		for _, e := range teamEntries {
+			if e.ai {
+				continue
+			}
+			s.capAiOpponents(e)
+			for j := range e.outcomes {
+				e.outcomes[j].room = report.RoomID
+			}
+			if sp, ok := e.player.(StreakPlayer); ok {
+				streak := sp.GetStreak()
+				if e.earlier != nil {
+					streak = prevStreak(e.earlier.Streak)
+				}
+				e.streak = nextStreak(streak, streakResult(e, teams))
+			}
+			humans = append(humans, e)
+		}
+	}
+	return humans, report
+}
+
+// settle 以 before 为基础根据 outcomes 计算玩家的结算结果
+func (s *Settler) settle(e *settleEntry, before Args, outcomes []outcome) PlayerSettlement {
+	after := s.rate(before, outcomes, e.placement)
+	adjustment := s.streakAdjustment(after, e.streak)
+	after = addArgs(after, adjustment)
+	return PlayerSettlement{
+		PlayerID:      e.player.ID(),
+		Placement:     e.placement,
+		Streak:        e.streak,
+		Participation: e.participation,
+		TeamRank:      e.teamRank,
+		Rank:          e.player.Rank(),
+		Before:        before,
+		After:         after,
+		Delta: Args{
+			MMR: after.MMR - before.MMR,
+			DR:  after.DR - before.DR,
+			V:   after.V - before.V,
+		},
+		Opponents:   len(outcomes),
+		AiOpponents: countAiOpponents(outcomes),
+		Adjustment:  adjustment,
+	}
+}
+
+// rate 以 before 为基础根据 outcomes 计算新的参数，定级期间 mmr 的变化放大 PlacementStepScale 倍
+func (s *Settler) rate(before Args, outcomes []outcome, placement bool) Args {
+	after := s.system().calculate(before, outcomes)
+	if placement && s.PlacementStepScale > 1 {
+		after.MMR = before.MMR + (after.MMR-before.MMR)*s.PlacementStepScale
+	}
+	return after
+}
+
+// applySettlement 将结算结果更新到玩家上，players 与 report.Players 一一对应
+func applySettlement(report *SettlementReport, players []Player) {
+	now := time.Now().Unix()
+	for i, p := range players {
+		ps := &report.Players[i]
+		if err := p.SetArgs(&ps.After); err != nil {
+			ps.Err = fmt.Errorf("set args for player %s: %w", ps.PlayerID, err)
+			report.Errors = append(report.Errors, ps.Err)
+			continue
+		}
+		if ap, ok := p.(ActivityPlayer); ok {
+			ap.SetRatedTimeSec(now)
+		}
+	}
+}
+
+// ApplyInactivity 按 glicko-2 算法增长不活跃玩家的评分偏差：玩家的参数最近一次更新之后每经过一个 InactivityPeriod，
+// RD² 增加一次 (σ·Scale)²，最多增长到 MaxInactivityDR。只处理实现了 ActivityPlayer 的真人玩家，
+// 会把玩家参数更新到的时间推进相应的周期数，所以可以重复调用。返回评分偏差有变化的玩家的结算报告。
+func (s *Settler) ApplyInactivity(players []Player, now time.Time) *SettlementReport {
+	report := &SettlementReport{}
+	period := int64(s.InactivityPeriod / time.Second)
+	if period <= 0 {
+		return report
+	}
+	rs := s.system()
+	maxDR := s.MaxInactivityDR
+	if maxDR <= 0 {
+		maxDR = rs.MaxDR
+	}
+	if maxDR <= 0 {
+		// 不活跃的玩家的评分偏差最多增长到与新玩家相同
+		maxDR = rs.DefaultDR
+	}
+
+	var journal []JournalEntry
+	for _, p := range players {
+		ap, ok := p.(ActivityPlayer)
+		if !ok || p.IsAi() {
+			continue
+		}
+		ratedSec := ap.GetRatedTimeSec()
+		if ratedSec == 0 {
+			// 不知道玩家什么时候开始不活跃的，从现在开始计算
+			ap.SetRatedTimeSec(now.Unix())
+			continue
+		}
+		periods := (now.Unix() - ratedSec) / period
+		if periods <= 0 {
+			continue
+		}
+
+		before := *p.GetArgs()
+		after := before
+		after.DR = rs.inflate(before, periods, maxDR)
+		ap.SetRatedTimeSec(ratedSec + periods*period)
+		if after.DR == before.DR {
+			continue
+		}
+
+		ps := PlayerSettlement{
+			PlayerID: p.ID(),
+			Before:   before,
+			After:    after,
+			Delta:    Args{DR: after.DR - before.DR},
+		}
+		if err := p.SetArgs(&after); err != nil {
+			ps.Err = fmt.Errorf("set args for player %s: %w", ps.PlayerID, err)
+			report.Errors = append(report.Errors, ps.Err)
+		} else {
+			journal = append(journal, newJournalEntry(JournalKindInactivity, 0, ps, nil))
+		}
+		report.Players = append(report.Players, ps)
+	}
+	s.writeJournal(report, journal)
+	return report
+}
+
+// addPairwiseMatches 玩家之间两两对局
+func (s *Settler) addPairwiseMatches(teams []Team, entries [][]*settleEntry) {
 	// 阵营间
 	// T1 > T2 > T3
 	// T2 > T3
-	teams := room.SortTeamByRank()
+	// 排名相同的阵营之间记为平局，所有阵营排名都相同时整局都是平局
 	for i := 0; i < len(teams)-1; i++ {
-		team1 := teams[i]
 		for j := i + 1; j < len(teams); j++ {
-			teamj := teams[j]
-			for _, g := range team1.Groups() {
-				for _, team1Player := range g.Players() {
-					if team1Player.IsAi() {
-						continue
-					}
-					t1p := team1Player.GlickoPlayer()
-					for _, g2 := range teamj.Groups() {
-						for _, teamjPlayer := range g2.Players() {
-							if teamjPlayer.IsAi() {
-								continue
-							}
-							period.AddMatch(t1p, teamjPlayer.GlickoPlayer(),
-								glicko.MATCH_RESULT_WIN)
-						}
-					}
+			result := resultByRank(teams[i].Rank(), teams[j].Rank())
+			for _, e1 := range entries[i] {
+				for _, e2 := range entries[j] {
+					s.addMatch(e1, e2, s.blendPerformance(result, e1.performance, e2.performance,
+						e1.hasPerformance && e2.hasPerformance))
 				}
 			}
 		}
@@ -47,43 +468,170 @@ func (s *Settler) UpdateMMR(room Room) {
 	// P2 > P3 > P4 > P5
 	// P3 > P4 > P5
 	// P4 > P5
-	for _, team1 := range teams {
-		team1Players := team1.SortPlayerByRank()
-		for j := 0; j < len(team1Players)-1; j++ {
-			if team1Players[j].IsAi() {
-				continue
-			}
-			tp1 := team1Players[j].GlickoPlayer()
-			for k := j + 1; k < len(team1Players); k++ {
-				if team1Players[k].IsAi() {
-					continue
+	// 排名相同的玩家之间记为平局，双方都有表现分时按表现分占比计算
+	for _, teamEntries := range entries {
+		for j := 0; j < len(teamEntries)-1; j++ {
+			for k := j + 1; k < len(teamEntries); k++ {
+				e1, e2 := teamEntries[j], teamEntries[k]
+				result := resultByRank(e1.player.Rank(), e2.player.Rank())
+				if e1.hasPerformance && e2.hasPerformance {
+					result = performanceShare(e1.performance, e2.performance)
 				}
-				period.AddMatch(tp1, team1Players[k].GlickoPlayer(), glicko.MATCH_RESULT_WIN)
+				s.addMatch(e1, e2, result)
 			}
 		}
 	}
+}
 
-	// 计算结果
-	period.Calculate()
+// addCompositeMatches 玩家与其他阵营的合成对手对局，合成对手不参与结算
+func (s *Settler) addCompositeMatches(teams []Team, entries [][]*settleEntry) {
+	composites := make([]*composite, len(teams))
+	for i, teamEntries := range entries {
+		composites[i] = newComposite(teamEntries)
+	}
 
-	// 输出更新后的结果
-	for _, team := range teams {
-		players := team.SortPlayerByRank()
-		for i := 0; i < len(players); i++ {
-			if players[i].IsAi() {
+	// 排名相同的阵营之间记为平局
+	for i, teamEntries := range entries {
+		for j := range teams {
+			c := composites[j]
+			if i == j || c == nil {
 				continue
 			}
-			rating := players[i].GlickoPlayer().Rating()
-			_ = players[i].SetArgs(&Args{
-				MMR: rating.R(),
-				DR:  rating.Rd(),
-				V:   rating.Sigma(),
-			})
-			fmt.Printf("Player #%s mmr: %0.2f, rd: %0.2f, v: %0.2f\n", players[i].ID(), rating.R(), rating.Rd(),
-				rating.Sigma())
+			result := resultByRank(teams[i].Rank(), teams[j].Rank())
+			for _, e := range teamEntries {
+				s.addOutcome(e, c.args, c.ai, c.against(s.blendPerformance(result, e.performance, c.performance,
+					e.hasPerformance && c.hasPerformance)))
+			}
+		}
+	}
+}
+
+// newComposite 合成阵营的对手：评分、波动率和表现分取平均值，评分偏差取均方根，阵营中没有参与结算的玩家时返回 nil。
+// 中途退出或挂机的玩家不计入合成的参数，全部玩家都退出或挂机时才计入
+func newComposite(teamEntries []*settleEntry) *composite {
+	if len(teamEntries) == 0 {
+		return nil
+	}
+	stayed := make([]*settleEntry, 0, len(teamEntries))
+	for _, e := range teamEntries {
+		if !e.abandoned() {
+			stayed = append(stayed, e)
+		}
+	}
+	res := &composite{
+		ai:        true,
+		abandoned: 1 - float64(len(stayed))/float64(len(teamEntries)),
+	}
+	if len(stayed) == 0 {
+		stayed = teamEntries
+	}
+	performers := 0
+	for _, e := range stayed {
+		res.ai = res.ai && e.ai
+		res.args.MMR += e.before.MMR
+		res.args.DR += e.before.DR * e.before.DR
+		res.args.V += e.before.V
+		if e.hasPerformance {
+			res.performance += e.performance
+			performers++
+		}
+	}
+	n := float64(len(stayed))
+	res.args.MMR /= n
+	res.args.DR = math.Sqrt(res.args.DR / n)
+	res.args.V /= n
+	if performers > 0 {
+		res.performance /= float64(performers)
+		res.hasPerformance = true
+	}
+	return res
+}
+
+// blendPerformance 按 PerformanceWeight 将阵营间的对局结果和双方的表现分占比加权
+func (s *Settler) blendPerformance(result glicko.MatchResult, p1, p2 float64, ok bool) glicko.MatchResult {
+	if !ok || s.PerformanceWeight <= 0 {
+		return result
+	}
+	w := math.Min(s.PerformanceWeight, 1)
+	return glicko.MatchResult((1-w)*float64(result) + w*float64(performanceShare(p1, p2)))
+}
+
+// performanceShare 根据双方表现分的占比计算前者的对局结果，双方都为 0 时为平局
+func performanceShare(p1, p2 float64) glicko.MatchResult {
+	p1, p2 = math.Max(p1, 0), math.Max(p2, 0)
+	if p1+p2 == 0 {
+		return glicko.MATCH_RESULT_DRAW
+	}
+	return glicko.MatchResult(p1 / (p1 + p2))
+}
+
+// addMatch 记录一场对局，result 为 e1 的结果。只有一方中途退出或挂机时，不论排名都记为另一方获胜
+func (s *Settler) addMatch(e1, e2 *settleEntry, result glicko.MatchResult) {
+	switch {
+	case e1.abandoned() && !e2.abandoned():
+		result = glicko.MATCH_RESULT_LOSS
+	case e2.abandoned() && !e1.abandoned():
+		result = glicko.MATCH_RESULT_WIN
+	}
+	s.addOutcome(e1, e2.before, e2.ai, result)
+	s.addOutcome(e2, e1.before, e1.ai, 1-result)
+}
+
+// addOutcome 为玩家记录一个对手的结果，ai 不记录。
+// 中途退出或挂机的玩家记为失败，中途加入的玩家按参与比例降低权重，退出者的队友按 LeaverTeammateLossReduction 降低失败的权重
+func (s *Settler) addOutcome(e *settleEntry, opponent Args, aiOpponent bool, score glicko.MatchResult) {
+	if e.ai {
+		return
+	}
+	if aiOpponent {
+		e.aiOpponents++
+	}
+
+	weight := 1.0
+	switch {
+	case e.abandoned():
+		score = glicko.MATCH_RESULT_LOSS
+	case e.participation == ParticipationLate:
+		weight = math.Max(0, math.Min(e.share, 1))
+	}
+	if e.leaverTeammate && !e.abandoned() && score < glicko.MATCH_RESULT_DRAW {
+		weight *= 1 - math.Max(0, math.Min(s.LeaverTeammateLossReduction, 1))
+	}
+	e.outcomes = append(e.outcomes, outcome{opponent: opponent, score: score, weight: weight, ai: aiOpponent})
+}
+
+// capAiOpponents ai 对手数超过 MaxAiOpponents 时，按比例降低所有 ai 对手的权重
+func (s *Settler) capAiOpponents(e *settleEntry) {
+	if s.MaxAiOpponents <= 0 || e.aiOpponents <= s.MaxAiOpponents {
+		return
+	}
+	scale := float64(s.MaxAiOpponents) / float64(e.aiOpponents)
+	for i := range e.outcomes {
+		if e.outcomes[i].ai {
+			e.outcomes[i].weight *= scale
+		}
+	}
+}
+
+// countAiOpponents 统计 ai 对手数
+func countAiOpponents(outcomes []outcome) int {
+	count := 0
+	for _, o := range outcomes {
+		if o.ai {
+			count++
 		}
 	}
+	return count
+}
 
-	fmt.Println("-----------------------------")
-	fmt.Println()
+// resultByRank 根据双方排名获取前者的对局结果，排名越小越靠前，排名相同为平局
+func resultByRank(rank1, rank2 int) glicko.MatchResult {
+	switch {
+	case rank1 < rank2:
+		return glicko.MATCH_RESULT_WIN
+	case rank1 > rank2:
+		return glicko.MATCH_RESULT_LOSS
+	default:
+		return glicko.MATCH_RESULT_DRAW
+	}
 }
@@ -0,0 +1,171 @@
+package glicko2
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var ErrRoomInRatingPeriod = errors.New("room was added to a rating period")
+
+// SettlementStore 保存已经结算过的房间的结算报告，Settler 据此避免重复结算同一个房间
+type SettlementStore interface {
+
+	// Load 获取房间的结算报告，没有结算过时返回 nil
+	Load(roomID int64) (*SettlementReport, error)
+
+	// Save 保存房间的结算报告，同一个房间重复保存时覆盖之前的报告
+	Save(report *SettlementReport) error
+}
+
+// MemorySettlementStore 是内存中的 SettlementStore，进程重启后会丢失
+type MemorySettlementStore struct {
+	sync.RWMutex
+	reports map[int64]*SettlementReport
+}
+
+func NewMemorySettlementStore() *MemorySettlementStore {
+	return &MemorySettlementStore{
+		reports: make(map[int64]*SettlementReport),
+	}
+}
+
+func (s *MemorySettlementStore) Load(roomID int64) (*SettlementReport, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.reports[roomID], nil
+}
+
+func (s *MemorySettlementStore) Save(report *SettlementReport) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.reports[report.RoomID] = report
+	return nil
+}
+
+// FileSettlementStore 是以文件保存的 SettlementStore，每个结算报告以一行 JSON 追加写入文件，
+// 打开时加载文件中所有的报告，同一个房间以最后一行为准
+type FileSettlementStore struct {
+	sync.Mutex
+	file   *os.File
+	memory *MemorySettlementStore
+}
+
+// storedReport 是结算报告保存到文件中的格式，错误只保存错误信息
+type storedReport struct {
+	RoomID      int64
+	Provisional bool
+	RolledBack  bool
+	Players     []storedPlayer
+	SkippedAi   []string
+	Errors      []string
+}
+
+type storedPlayer struct {
+	PlayerSettlement
+	Err string
+}
+
+// NewFileSettlementStore 打开或创建 path 对应的文件，并加载其中的结算报告
+func NewFileSettlementStore(path string) (*FileSettlementStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open settlement store: %w", err)
+	}
+	s := &FileSettlementStore{
+		file:   file,
+		memory: NewMemorySettlementStore(),
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var stored storedReport
+		if err := json.Unmarshal(scanner.Bytes(), &stored); err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("decode settlement store line %d: %w", line, err)
+		}
+		_ = s.memory.Save(stored.report())
+	}
+	if err := scanner.Err(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("read settlement store: %w", err)
+	}
+	return s, nil
+}
+
+func (s *FileSettlementStore) Load(roomID int64) (*SettlementReport, error) {
+	return s.memory.Load(roomID)
+}
+
+func (s *FileSettlementStore) Save(report *SettlementReport) error {
+	data, err := json.Marshal(newStoredReport(report))
+	if err != nil {
+		return fmt.Errorf("encode settlement report for room %d: %w", report.RoomID, err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write settlement report for room %d: %w", report.RoomID, err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("sync settlement store: %w", err)
+	}
+	return s.memory.Save(report)
+}
+
+// Close 关闭文件
+func (s *FileSettlementStore) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.file.Close()
+}
+
+func newStoredReport(report *SettlementReport) storedReport {
+	res := storedReport{
+		RoomID:      report.RoomID,
+		Provisional: report.Provisional,
+		RolledBack:  report.RolledBack,
+		Players:     make([]storedPlayer, len(report.Players)),
+		SkippedAi:   report.SkippedAi,
+	}
+	for i, ps := range report.Players {
+		res.Players[i].PlayerSettlement = ps
+		res.Players[i].PlayerSettlement.Err = nil
+		if ps.Err != nil {
+			res.Players[i].Err = ps.Err.Error()
+		}
+	}
+	for _, err := range report.Errors {
+		res.Errors = append(res.Errors, err.Error())
+	}
+	return res
+}
+
+func (r storedReport) report() *SettlementReport {
+	res := &SettlementReport{
+		RoomID:      r.RoomID,
+		Provisional: r.Provisional,
+		RolledBack:  r.RolledBack,
+		Players:     make([]PlayerSettlement, len(r.Players)),
+		SkippedAi:   r.SkippedAi,
+	}
+	for i, sp := range r.Players {
+		res.Players[i] = sp.PlayerSettlement
+		if sp.Err != "" {
+			res.Players[i].Err = errors.New(sp.Err)
+		}
+	}
+	for _, err := range r.Errors {
+		res.Errors = append(res.Errors, errors.New(err))
+	}
+	return res
+}
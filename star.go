@@ -0,0 +1,292 @@
+package glicko2
+
+import (
+	"math"
+)
+
+// Tier 是一个段位，段位之间以星数为界
+type Tier struct {
+	Name    string
+	MinStar int // 段位的起始星数
+
+	Floor          bool   // 达到该段位后不会再降到更低的段位
+	ProtectedGames int    // 晋升到该段位后的保护局数，保护期内不会降到更低的段位
+	Promotion      Series // 从更低的段位晋升到该段位的晋级赛，Games 为 0 表示直接晋升
+	Demotion       Series // 从该段位降到更低段位前的保级赛，Games 为 0 表示直接降级
+}
+
+// Series 是晋级赛或保级赛，Games 局中赢下 Wins 局即成功
+type Series struct {
+	Games int
+	Wins  int // 为 0 时默认为 Games/2+1
+}
+
+// wins 获取需要赢下的局数
+func (s Series) wins() int {
+	if s.Wins <= 0 || s.Wins > s.Games {
+		return s.Games/2 + 1
+	}
+	return s.Wins
+}
+
+// LadderState 是玩家在段位晋升中的状态
+type LadderState struct {
+	InSeries       bool // 是否在晋级赛或保级赛中
+	Promotion      bool // 是晋级赛还是保级赛
+	SeriesTier     int  // 晋级赛要晋升到的段位或保级赛要保住的段位，是 StarLadderArgs.Tiers 的下标
+	SeriesWins     int  // 晋级赛或保级赛中赢下的局数
+	SeriesLosses   int  // 晋级赛或保级赛中输掉的局数
+	ProtectedGames int  // 剩余的保护局数
+}
+
+// LadderPlayer 是可以保存段位晋升状态的玩家，只有实现了该接口的玩家才会进行晋级赛、保级赛和段位保护
+type LadderPlayer interface {
+	GetLadderState() LadderState
+	SetLadderState(state LadderState)
+}
+
+// StarLadder 根据赛后排名增减玩家的星数（Player.Star），与 Settler 一起使用，使星数随着隐藏的 mmr 变化
+type StarLadder struct {
+	StarLadderArgs
+}
+
+// StarLadderArgs 段位晋升参数
+type StarLadderArgs struct {
+	// 阵营排名对应的星数变化，下标为排名-1，超出的排名使用最后一个。中途退出或挂机的玩家按最后一个计算
+	RankStars []int
+	Tiers     []Tier // 所有段位，按 MinStar 升序排列
+
+	// mmr 加星：获得星星时，玩家的 mmr 每超出当前星数对应的 mmr（BaseMMR + 星数 * MMRPerStar）BonusMMRGap，
+	// 额外加 1 颗星，最多加 MaxBonusStars 颗。任意一个为 0 表示不开启
+	BaseMMR       float64
+	MMRPerStar    float64
+	BonusMMRGap   float64
+	MaxBonusStars int
+}
+
+func NewStarLadder(args StarLadderArgs) *StarLadder {
+	return &StarLadder{
+		StarLadderArgs: args,
+	}
+}
+
+// LadderReport 是一局游戏的段位晋升报告
+type LadderReport struct {
+	RoomID  int64
+	Players []PlayerLadder // 真人玩家，按阵营排名和阵营内排名排序
+}
+
+// PlayerLadder 是一个玩家的段位晋升结果
+type PlayerLadder struct {
+	PlayerID   string
+	BeforeStar int
+	AfterStar  int
+	BonusStars int // 其中 mmr 加星的数量
+
+	BeforeTier int  // 结算前的段位，是 StarLadderArgs.Tiers 的下标，低于所有段位时为 -1
+	AfterTier  int  // 结算后的段位
+	Protected  bool // 是否因为段位保护没有降级
+
+	State LadderState // 结算后的晋升状态
+}
+
+// Update 根据阵营排名更新房间中所有真人玩家的星数，mmr 加星使用玩家当前的 mmr，所以应该在 Settler.UpdateMMR 之后调用
+func (l *StarLadder) Update(room Room) *LadderReport {
+	report := &LadderReport{
+		RoomID: room.GetID(),
+	}
+	for _, team := range room.SortTeamByRank() {
+		for _, p := range team.SortPlayerByRank() {
+			if p.IsAi() {
+				continue
+			}
+			report.Players = append(report.Players, l.update(p, team.Rank()))
+		}
+	}
+	return report
+}
+
+// update 更新一个玩家的星数
+func (l *StarLadder) update(p Player, teamRank int) PlayerLadder {
+	var state LadderState
+	lp, hasState := p.(LadderPlayer)
+	if hasState {
+		state = lp.GetLadderState()
+	}
+
+	star := p.Star()
+	res := PlayerLadder{
+		PlayerID:   p.ID(),
+		BeforeStar: star,
+		BeforeTier: l.tierOf(star),
+	}
+
+	delta := l.rankStars(teamRank, p)
+	if delta > 0 {
+		res.BonusStars = l.bonusStars(p.MMR(), star)
+		delta += res.BonusStars
+	}
+
+	switch {
+	case state.InSeries:
+		star = l.playSeries(&state, star, delta)
+	case delta > 0:
+		star = l.promote(&state, star, delta, hasState)
+	case delta < 0:
+		star, res.Protected = l.demote(&state, star, delta, hasState)
+	default:
+		if state.ProtectedGames > 0 {
+			state.ProtectedGames--
+		}
+	}
+
+	res.AfterStar = star
+	res.AfterTier = l.tierOf(star)
+	res.State = state
+	p.SetStar(star)
+	if hasState {
+		lp.SetLadderState(state)
+	}
+	return res
+}
+
+// rankStars 获取阵营排名对应的星数变化
+func (l *StarLadder) rankStars(teamRank int, p Player) int {
+	if len(l.RankStars) == 0 {
+		return 0
+	}
+	last := len(l.RankStars) - 1
+	if pp, ok := p.(ParticipationPlayer); ok {
+		if participation, _ := pp.Participation(); participation == ParticipationLeft || participation == ParticipationAfk {
+			return l.RankStars[last]
+		}
+	}
+	switch i := teamRank - 1; {
+	case i < 0:
+		return l.RankStars[0]
+	case i > last:
+		return l.RankStars[last]
+	default:
+		return l.RankStars[i]
+	}
+}
+
+// bonusStars 根据 mmr 超出星数对应 mmr 的程度计算额外加的星数
+func (l *StarLadder) bonusStars(mmr float64, star int) int {
+	if l.MMRPerStar <= 0 || l.BonusMMRGap <= 0 || l.MaxBonusStars <= 0 {
+		return 0
+	}
+	gap := mmr - (l.BaseMMR + float64(star)*l.MMRPerStar)
+	if gap <= 0 {
+		return 0
+	}
+	return int(math.Min(math.Floor(gap/l.BonusMMRGap), float64(l.MaxBonusStars)))
+}
+
+// promote 加星，跨过有晋级赛的段位时停在段位前一星并开始晋级赛
+func (l *StarLadder) promote(state *LadderState, star, delta int, hasState bool) int {
+	from := l.tierOf(star)
+	target := star + delta
+	for i := from + 1; i < len(l.Tiers); i++ {
+		t := l.Tiers[i]
+		if t.MinStar > target {
+			break
+		}
+		if hasState && t.Promotion.Games > 0 {
+			*state = LadderState{
+				InSeries:       true,
+				Promotion:      true,
+				SeriesTier:     i,
+				ProtectedGames: state.ProtectedGames,
+			}
+			return t.MinStar - 1
+		}
+	}
+
+	if to := l.tierOf(target); to > from && to >= 0 {
+		state.ProtectedGames = l.Tiers[to].ProtectedGames
+	} else if state.ProtectedGames > 0 {
+		state.ProtectedGames--
+	}
+	return target
+}
+
+// demote 扣星，跌出当前段位时按保护、保级赛的顺序处理，返回扣星后的星数和是否因为段位保护没有降级
+func (l *StarLadder) demote(state *LadderState, star, delta int, hasState bool) (int, bool) {
+	target := star + delta
+	if target < 0 {
+		target = 0
+	}
+	tier := l.tierOf(star)
+	protected := state.ProtectedGames > 0
+	if state.ProtectedGames > 0 {
+		state.ProtectedGames--
+	}
+	if tier < 0 || target >= l.Tiers[tier].MinStar {
+		return target, false
+	}
+
+	t := l.Tiers[tier]
+	if t.Floor || protected {
+		return t.MinStar, true
+	}
+	if hasState && t.Demotion.Games > 0 {
+		*state = LadderState{
+			InSeries:   true,
+			SeriesTier: tier,
+		}
+		return t.MinStar, false
+	}
+	return target, false
+}
+
+// playSeries 进行一局晋级赛或保级赛，加星视为赢下一局，扣星视为输掉一局
+func (l *StarLadder) playSeries(state *LadderState, star, delta int) int {
+	if state.SeriesTier < 0 || state.SeriesTier >= len(l.Tiers) {
+		// 段位配置变了，放弃进行中的晋级赛或保级赛
+		*state = LadderState{}
+		return star
+	}
+	switch {
+	case delta > 0:
+		state.SeriesWins++
+	case delta < 0:
+		state.SeriesLosses++
+	}
+
+	t := l.Tiers[state.SeriesTier]
+	promotion := state.Promotion
+	series := t.Demotion
+	if promotion {
+		series = t.Promotion
+	}
+	switch {
+	case state.SeriesWins >= series.wins():
+		// 晋级成功后进入保护期，保级成功则保留原来的保护局数
+		protectedGames := state.ProtectedGames
+		if promotion {
+			protectedGames = t.ProtectedGames
+		}
+		*state = LadderState{ProtectedGames: protectedGames}
+		return t.MinStar
+	case state.SeriesLosses > series.Games-series.wins():
+		// 晋级失败停在段位前一星，保级失败降到更低段位的最高星
+		*state = LadderState{}
+		if t.MinStar == 0 {
+			return 0
+		}
+		return t.MinStar - 1
+	}
+	return star
+}
+
+// tierOf 获取星数所在的段位下标，低于所有段位时返回 -1
+func (l *StarLadder) tierOf(star int) int {
+	res := -1
+	for i, t := range l.Tiers {
+		if star >= t.MinStar {
+			res = i
+		}
+	}
+	return res
+}
@@ -0,0 +1,292 @@
+package glicko2
+
+import (
+	"math"
+	"sort"
+)
+
+// MatchState 是一轮匹配的输入和输出状态
+type MatchState struct {
+	Groups  []Group // 还没有进入阵营的队伍
+	TmpTeam []Team  // 临时阵营
+	TmpRoom []Room  // 临时房间
+}
+
+// MatchStrategy 是队列的组队和组房策略，可以通过 QueueArgs.Strategy 为每个队列单独配置
+type MatchStrategy interface {
+
+	// Match 根据本轮要匹配的队伍和上一轮遗留的临时阵营、临时房间进行匹配，
+	// 返回组满的房间和遗留下来的队伍、临时阵营和临时房间
+	Match(q *Queue, state MatchState) ([]Room, MatchState)
+}
+
+// GreedyStrategy 是默认的匹配策略
+type GreedyStrategy struct{}
+
+// Match 贪心匹配：先把 group 按 mmr 填进最接近的阵营，再把组满的阵营两两组成房间
+func (s GreedyStrategy) Match(q *Queue, state MatchState) ([]Room, MatchState) {
+	var groups = state.Groups
+	var tmpTeam = state.TmpTeam
+	var tmpRoom = state.TmpRoom
+	var rooms = make([]Room, 0)
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].MMR() < groups[j].MMR()
+	})
+
+	// 获取所有的玩家个数
+	totalPlayerCount := 0
+	for _, g := range groups {
+		totalPlayerCount += len(g.Players())
+	}
+	for _, t := range tmpTeam {
+		totalPlayerCount += t.PlayerCount()
+	}
+	for _, r := range tmpRoom {
+		totalPlayerCount += r.PlayerCount()
+	}
+
+	sort.Slice(tmpTeam, func(i, j int) bool {
+		return tmpTeam[i].AverageMMR() < tmpTeam[j].AverageMMR()
+	})
+
+	// 尝试构建 totalPlayerCount/RoomPlayerLimit + 1 个 room
+	for k := 0; k < totalPlayerCount/q.RoomPlayerLimit+1; k++ {
+		// 优先把 tmp team 填满
+		for _, tt := range tmpTeam {
+			for tt.PlayerCount() != q.TeamPlayerLimit {
+				var found bool
+				groups, found = s.findGroupForTeam(q, tt, groups)
+				if !found {
+					break
+				}
+			}
+		}
+
+		// 获取还在队列中的玩家数，尝试构建新的 team
+		notInTeamPlayerCount := 0
+		for _, g := range groups {
+			notInTeamPlayerCount += len(g.Players())
+		}
+
+		// 再去构建新的 team
+		for i := 0; i < notInTeamPlayerCount/q.TeamPlayerLimit+1; i++ {
+			team := q.NewTeam()
+			for team.PlayerCount() != q.TeamPlayerLimit {
+				var found bool
+				groups, found = s.findGroupForTeam(q, team, groups)
+				if !found {
+					break
+				}
+			}
+			if team.PlayerCount() == 0 {
+				break
+			}
+			tmpTeam = append(tmpTeam, team)
+		}
+
+		// 优先在 tmpRoom 中创建房间
+		for _, tr := range tmpRoom {
+			if len(tr.Teams()) == q.RoomTeamLimit {
+				continue
+			}
+			for len(tr.Teams()) != q.RoomTeamLimit {
+				var found bool
+				tmpTeam, found = s.findTeamForRoom(q, tr, tmpTeam)
+				if !found {
+					break
+				}
+			}
+		}
+
+		// 尝试继续创建新的房间
+		tryRoomTimes := len(tmpTeam) / q.RoomTeamLimit
+		for l := 0; l < tryRoomTimes+1; l++ {
+			room := q.NewRoom()
+			for len(room.Teams()) != q.RoomTeamLimit {
+				var found bool
+				tmpTeam, found = s.findTeamForRoom(q, room, tmpTeam)
+				if !found {
+					break
+				}
+			}
+			if len(room.Teams()) == 0 {
+				break
+			}
+			tmpRoom = append(tmpRoom, room)
+		}
+
+		// 尝试填充 ai
+		for _, tr := range tmpRoom {
+			teams := tr.Teams()
+			if len(teams) == 0 || len(teams) == q.RoomTeamLimit {
+				continue
+			}
+			for _, team := range teams {
+				canFillAi := true
+				for _, g := range tr.Teams()[0].Groups() {
+					if !g.CanFillAi() {
+						canFillAi = false
+						break
+					}
+				}
+				if !canFillAi {
+					continue
+				}
+				tr.RemoveTeam(team)
+				newRoom := q.NewRoomWithAi(team)
+				tmpRoom = append(tmpRoom, newRoom)
+			}
+		}
+
+		// 整理房间信息
+		newTmpRoom := make([]Room, 0)
+		for _, tr := range tmpRoom {
+			if len(tr.Teams()) == q.RoomTeamLimit {
+				rooms = append(rooms, tr)
+				continue
+			}
+			newTmpRoom = append(newTmpRoom, tr)
+		}
+		tmpRoom = newTmpRoom
+	}
+
+	return rooms, MatchState{
+		Groups:  groups,
+		TmpTeam: tmpTeam,
+		TmpRoom: tmpRoom,
+	}
+}
+
+// findGroupForTeam 从 groups 中找到适合 team 的 group 并加入其中
+func (s GreedyStrategy) findGroupForTeam(q *Queue, team Team, groups []Group) ([]Group, bool) {
+	// 第1个队伍直接进
+	if team.PlayerCount() == 0 && len(groups) > 0 {
+		team.AddGroup(groups[0])
+		groups = groups[1:]
+		return groups, true
+	}
+
+	// 寻找平均 mmr 最接近的 group 组成一个 team
+	closestIndex := -1
+	for i, group := range groups {
+		// 优先找能凑满队的
+		if team.PlayerCount()+len(group.Players()) == q.TeamPlayerLimit && (closestIndex == -1 || math.Abs(group.MMR()-team.AverageMMR()) < math.Abs(groups[closestIndex].MMR()-team.AverageMMR())) {
+			closestIndex = i
+		}
+	}
+	if closestIndex == -1 {
+		// 不能一次性组满队，就先临时组一个队，后面再尝试组满
+		for i, group := range groups {
+			if team.PlayerCount()+len(group.Players()) <= q.TeamPlayerLimit && (closestIndex == -1 || math.Abs(group.MMR()-team.AverageMMR()) < math.Abs(groups[closestIndex].MMR()-team.AverageMMR())) {
+				closestIndex = i
+			}
+		}
+		// 如果没有找到合适的 group，则直接返回，这里一般是因为 group 列表为空
+		if closestIndex == -1 {
+			return groups, false
+		}
+	}
+
+	if s.canGroupTogether(q, team, groups[closestIndex]) {
+		team.AddGroup(groups[closestIndex])
+		groups = append(groups[:closestIndex], groups[closestIndex+1:]...)
+		return groups, true
+	}
+
+	return groups, false
+}
+
+// findTeamForRoom 从 tmpTeam 中找到合适 room 的 team 并加入其中
+func (s GreedyStrategy) findTeamForRoom(q *Queue, room Room, tmpTeam []Team) ([]Team, bool) {
+	for tPos, tt := range tmpTeam {
+		if len(room.Teams()) >= q.RoomTeamLimit {
+			break
+		}
+		// 只有当 team 已经组建完毕了，才可以加入到 room 中
+		if tt.PlayerCount() != q.TeamPlayerLimit {
+			continue
+		}
+		// 如果 room 中没有 team，则第 1 个直接加入 room 中
+		if len(room.Teams()) == 0 {
+			room.AddTeam(tt)
+			tmpTeam = append(tmpTeam[:tPos], tmpTeam[tPos+1:]...)
+			return tmpTeam, true
+		} else {
+			if s.canTeamTogether(q, room, tt) {
+				room.AddTeam(tt)
+				tmpTeam = append(tmpTeam[:tPos], tmpTeam[tPos+1:]...)
+				return tmpTeam, true
+			}
+		}
+	}
+
+	// 没找着
+	return tmpTeam, false
+}
+
+// canGroupTogether 判断队伍之间是否可以组成一个阵营
+func (s GreedyStrategy) canGroupTogether(q *Queue, team Team, group Group) bool {
+	for _, g := range team.Groups() {
+		if !s.canGroupPair(q, g, group) {
+			return false
+		}
+	}
+	return true
+}
+
+// canGroupPair 判断 group 是否可以加入已有 g 的阵营
+func (s GreedyStrategy) canGroupPair(q *Queue, g, group Group) bool {
+	mr := q.GetMatchRange(q.matchStartSec(g.GetStartMatchTimeSec(), g), q.matchStartSec(group.GetStartMatchTimeSec(), group))
+
+	// 是否加入车队
+	if len(g.Players()) != q.TeamPlayerLimit && !mr.CanJoinTeam && len(group.Players()) == q.TeamPlayerLimit {
+		return false
+	}
+
+	// mmr 是否匹配
+	gMMR := g.MMR()
+	if mr.MMRGapPercent != 0 && math.Abs(gMMR-group.MMR()) > g.MMR()*float64(mr.MMRGapPercent)/100 {
+		return false
+	}
+
+	// 段位是否匹配
+	if mr.StarGap != 0 && int(math.Abs(float64(g.Star()-group.Star()))) > mr.StarGap {
+		return false
+	}
+	return true
+}
+
+// canTeamTogether 判断阵营之间是否可以组成一个房间
+func (s GreedyStrategy) canTeamTogether(q *Queue, room Room, tt Team) bool {
+	// 判断 tt 是否满足跟当前 room 中的所有 team 匹配的条件
+	// 只要有一个不满足，就返回 false
+	for _, t := range room.Teams() {
+		mr := q.GetMatchRange(q.teamMatchStartSec(t), q.teamMatchStartSec(tt))
+		// 是否加入车队
+		if len(t.Groups()) > 1 && !mr.CanJoinTeam && len(tt.Groups()) == 1 {
+			return false
+		}
+
+		// mmr 是否匹配
+		tMMR := t.AverageMMR()
+		if mr.MMRGapPercent != 0 && math.Abs(tMMR-tt.AverageMMR()) > tMMR*float64(mr.MMRGapPercent)/100 {
+			return false
+		}
+
+		// 段位是否匹配
+		if mr.StarGap != 0 && int(math.Abs(float64(t.Star()-tt.Star()))) > mr.StarGap {
+			return false
+		}
+	}
+
+	// 最强阵营的期望胜率是否过高
+	mr := q.GetMatchRange(q.roomMatchStartSec(room), q.teamMatchStartSec(tt))
+	if mr.MaxWinProbability != 0 {
+		teams := append(append(make([]Team, 0, len(room.Teams())+1), room.Teams()...), tt)
+		if q.RatingSystem.withDefaults().teamsQuality(teams).FavoriteExpected > mr.MaxWinProbability {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package glicko2
+
+import (
+	"math"
+)
+
+// StreakPlayer 是可以记录连胜连败的玩家，一局的胜负按阵营与其他阵营的排名计算，与玩家在阵营内的排名无关
+type StreakPlayer interface {
+
+	// 当前的连胜（正数）或连败（负数）局数，0 表示没有连胜连败
+	GetStreak() int
+	SetStreak(streak int)
+}
+
+// StreakArgs 连胜连败调整参数：glicko-2 的波动率变化较慢，连胜或连败达到 MinStreak 局后，每局结算后额外提高玩家的波动率和评分偏差，
+// 使其评分更快地向真实水平移动。只对实现了 StreakPlayer 的玩家生效
+type StreakArgs struct {
+	MinStreak  int  // 连胜或连败达到该局数后开始调整，0 表示不开启
+	OnlyLosing bool // 只调整连败
+
+	VolatilityScale float64 // 波动率放大的倍数，不大于 1 时不调整
+	MaxVolatility   float64 // 放大后波动率的上限，0 表示不限制
+	DRIncrease      float64 // 评分偏差增加的值，配置了 RatingSystem.MaxDR 时不超过该上限
+}
+
+// streakResult 根据阵营与其他阵营的排名判断玩家一局的胜负，1 为胜，-1 为负，0 为平。
+// 中途退出或挂机的玩家总是负，其他玩家排名比自己阵营低的阵营比高的多时为胜，少时为负
+func streakResult(e *settleEntry, teams []Team) int {
+	if e.abandoned() {
+		return -1
+	}
+	result := 0
+	for _, team := range teams {
+		switch {
+		case team.Rank() > e.teamRank:
+			result++
+		case team.Rank() < e.teamRank:
+			result--
+		}
+	}
+	switch {
+	case result > 0:
+		return 1
+	case result < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// nextStreak 根据这一局的胜负计算新的连胜连败局数，平局时清零
+func nextStreak(streak, result int) int {
+	switch {
+	case result > 0 && streak > 0:
+		return streak + 1
+	case result < 0 && streak < 0:
+		return streak - 1
+	default:
+		return result
+	}
+}
+
+// prevStreak 根据一局之后的连胜连败局数还原这局之前的局数，用于重新结算。
+// 这局打断了之前的连胜连败时无法还原，当作 0
+func prevStreak(streak int) int {
+	switch {
+	case streak > 1:
+		return streak - 1
+	case streak < -1:
+		return streak + 1
+	default:
+		return 0
+	}
+}
+
+// streakAdjustment 获取连胜连败对结算后参数的调整量
+func (s *Settler) streakAdjustment(after Args, streak int) Args {
+	st := s.Streak
+	if st.MinStreak <= 0 || (st.OnlyLosing && streak > 0) {
+		return Args{}
+	}
+	if streak < st.MinStreak && -streak < st.MinStreak {
+		return Args{}
+	}
+
+	var res Args
+	if st.VolatilityScale > 1 {
+		v := after.V * st.VolatilityScale
+		if st.MaxVolatility > 0 {
+			v = math.Min(v, math.Max(st.MaxVolatility, after.V))
+		}
+		res.V = v - after.V
+	}
+	if st.DRIncrease > 0 {
+		res.DR = math.Max(s.system().clampDR(after.DR+st.DRIncrease), after.DR) - after.DR
+	}
+	return res
+}
+
+// saveStreaks 保存玩家这一局之后的连胜连败局数
+func saveStreaks(entries []*settleEntry) {
+	for _, e := range entries {
+		if sp, ok := e.player.(StreakPlayer); ok {
+			sp.SetStreak(e.streak)
+		}
+	}
+}
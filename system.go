@@ -0,0 +1,176 @@
+package glicko2
+
+import (
+	"math"
+
+	glicko "github.com/zelenin/go-glicko2"
+)
+
+const (
+	defaultTau     = 0.5
+	defaultEpsilon = 0.000001
+)
+
+// RatingSystem 是 glicko-2 评分系统的常量和评分尺度，字段为 0 时使用 glicko-2 的默认值
+type RatingSystem struct {
+	Tau     float64 // 系统常数 τ，限制波动率在每个计算周期内的变化，一般取 0.3~1.2，默认 0.5
+	Epsilon float64 // 迭代计算波动率时的收敛精度，默认 0.000001
+
+	DefaultMMR float64 // 新玩家的默认评分，也是评分尺度的中心，默认 1500
+	DefaultDR  float64 // 新玩家的默认评分偏差，默认 350
+	DefaultV   float64 // 新玩家的默认波动率，默认 0.06
+
+	// 评分尺度与 glicko-2 内部尺度的换算比例，默认 173.7178，即评分相差 400 时期望胜率约为 10:1。
+	// 评分尺度更大时（如 1000~7500）可以按比例调大
+	Scale float64
+
+	MinDR float64 // 计算后评分偏差的下限，默认 0 表示不限制
+	MaxDR float64 // 计算后评分偏差的上限，默认 0 表示不限制
+}
+
+// withDefaults 返回填充了默认值的评分系统
+func (rs RatingSystem) withDefaults() RatingSystem {
+	if rs.Tau <= 0 {
+		rs.Tau = defaultTau
+	}
+	if rs.Epsilon <= 0 {
+		rs.Epsilon = defaultEpsilon
+	}
+	if rs.DefaultMMR == 0 {
+		rs.DefaultMMR = glicko.RATING_BASE_R
+	}
+	if rs.DefaultDR <= 0 {
+		rs.DefaultDR = glicko.RATING_BASE_RD
+	}
+	if rs.DefaultV <= 0 {
+		rs.DefaultV = glicko.RATING_BASE_SIGMA
+	}
+	if rs.Scale <= 0 {
+		rs.Scale = glicko.RATING_SCALE_PARAMETER
+	}
+	return rs
+}
+
+// DefaultArgs 获取新玩家的默认参数
+func (rs RatingSystem) DefaultArgs() Args {
+	rs = rs.withDefaults()
+	return Args{
+		MMR: rs.DefaultMMR,
+		DR:  rs.DefaultDR,
+		V:   rs.DefaultV,
+	}
+}
+
+// MatchQuality 与 MatchQuality 相同，但使用该评分系统的评分尺度
+func (rs RatingSystem) MatchQuality(room Room) Quality {
+	return rs.withDefaults().teamsQuality(room.Teams())
+}
+
+// normalize 补全参数：参数全为 0 的视为新玩家，使用默认参数；波动率不为正数时使用默认波动率。需要先填充默认值
+func (rs RatingSystem) normalize(a Args) Args {
+	if a == (Args{}) {
+		return Args{MMR: rs.DefaultMMR, DR: rs.DefaultDR, V: rs.DefaultV}
+	}
+	if a.V <= 0 {
+		a.V = rs.DefaultV
+	}
+	return a
+}
+
+// clampDR 将评分偏差限制在 [MinDR, MaxDR] 内，MaxDR 为 0 时没有上限
+func (rs RatingSystem) clampDR(dr float64) float64 {
+	if rs.MaxDR > 0 {
+		dr = math.Min(dr, rs.MaxDR)
+	}
+	return math.Max(rs.MinDR, dr)
+}
+
+// toGlickoScale 将评分和评分偏差转换为 glicko-2 尺度，需要先填充默认值
+func (rs RatingSystem) toGlickoScale(r, rd float64) (mu, phi float64) {
+	return (r - rs.DefaultMMR) / rs.Scale, rd / rs.Scale
+}
+
+// calculate 在一个 glicko-2 计算周期内根据对局结果计算新的参数，没有权重大于 0 的对局时参数不变，需要先填充默认值
+func (rs RatingSystem) calculate(before Args, outcomes []outcome) Args {
+	if len(outcomes) == 0 {
+		return before
+	}
+	before = rs.normalize(before)
+	mu, phi := rs.toGlickoScale(before.MMR, before.DR)
+
+	// 第 3、4 步：估计方差 v 和评分改进量 delta，每个对局按权重计入
+	v, dp := 0.0, 0.0
+	for _, o := range outcomes {
+		if o.weight <= 0 {
+			continue
+		}
+		opponent := rs.normalize(o.opponent)
+		muJ, phiJ := rs.toGlickoScale(opponent.MMR, opponent.DR)
+		g := glickoG(phiJ)
+		e := expectedScore(mu, muJ, phiJ)
+		v += o.weight * g * g * e * (1 - e)
+		dp += o.weight * g * (float64(o.score) - e)
+	}
+	if v == 0 {
+		return before
+	}
+	v = 1 / v
+	delta := v * dp
+
+	// 第 5~8 步：更新波动率、评分偏差和评分
+	sigma := rs.volatility(delta, phi, v, before.V)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*dp
+
+	return Args{
+		MMR: newMu*rs.Scale + rs.DefaultMMR,
+		DR:  rs.clampDR(newPhi * rs.Scale),
+		V:   sigma,
+	}
+}
+
+// volatility 使用 Illinois 算法迭代计算新的波动率
+func (rs RatingSystem) volatility(delta, phi, v, sigma float64) float64 {
+	a := math.Log(sigma * sigma)
+	tau := rs.Tau
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > rs.Epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+// inflate 按 glicko-2 算法增长 periods 个没有对局的计算周期后的评分偏差，最多增长到 maxDR，需要先填充默认值
+func (rs RatingSystem) inflate(a Args, periods int64, maxDR float64) float64 {
+	if a.DR >= maxDR {
+		return a.DR
+	}
+	sigma := rs.normalize(a).V * rs.Scale
+	return math.Min(math.Sqrt(a.DR*a.DR+float64(periods)*sigma*sigma), maxDR)
+}